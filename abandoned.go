@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// statusClientClosedRequest is the non-standard status, borrowed from nginx, logged for requests whose client
+// went away before they were handled. It is never written since there is no one left to read it.
+const statusClientClosedRequest = 499
+
+// skipAbandoned doesn't call the handler for requests whose client disconnected while they waited in the
+// middleware, so that no work is done for a response nobody will read. They are logged with a 499 status
+// and `abandoned`, and counted by counter.
+//
+// Requests whose deadline passed are still handled, the client is waiting for a response to them.
+func skipAbandoned(counter metric.Int64Counter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !errors.Is(r.Context().Err(), context.Canceled) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			markAbandoned(r, counter)
+		})
+	}
+}
+
+// markAbandoned logs r with a 499 status and `abandoned`, and counts it by counter. Nothing is written, so
+// callers return without a response.
+func markAbandoned(r *http.Request, counter metric.Int64Counter) {
+	setLogStatus(r, statusClientClosedRequest)
+	addLogField(r, slog.Bool("abandoned", true))
+	// the metrics SDK drops measurements made with a done context, which the request's always is here
+	counter.Add(context.WithoutCancel(r.Context()), 1, metric.WithAttributes(attribute.String("route", routePattern(r))))
+}
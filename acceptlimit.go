@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/time/rate"
+)
+
+// throttledListener limits the rate at which connections are accepted. Connections beyond the rate
+// wait in the kernel's accept backlog, or are refused by the kernel once it is full, so that a storm of
+// new connections can't exhaust resources before per-request limits apply.
+type throttledListener struct {
+	net.Listener
+	limiter *rate.Limiter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// throttleListener returns ln accepting at most perSecond connections per second, with bursts of up to burst.
+func throttleListener(ln net.Listener, perSecond float64, burst int) net.Listener {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &throttledListener{
+		Listener: ln,
+		limiter:  rate.NewLimiter(rate.Limit(perSecond), burst),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+func (l *throttledListener) Accept() (net.Conn, error) {
+	// a closed listener fails Accept right away rather than after waiting for the limiter
+	if err := l.limiter.Wait(l.ctx); err != nil {
+		return nil, net.ErrClosed
+	}
+
+	return l.Listener.Accept()
+}
+
+func (l *throttledListener) Close() error {
+	l.cancel()
+	return l.Listener.Close()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+// mountOpsRoutes registers the enabled operational endpoints on r.
+// They are mounted outside of the request middleware so that they are excluded from
+// access logs and traces. metricsHandler is nil when metrics are disabled.
+func mountOpsRoutes(r chi.Router, cfg *config, metricsHandler http.Handler, drain *drainState, ready *readiness, recent *recentErrors) {
+	if metricsHandler != nil {
+		r.Handle("/metrics", metricsHandler)
+	}
+
+	if cfg.adminEnabled {
+		r.Mount("/admin", newAdminRouter(drain, ready, recent, cfg.adminAllowedIPs))
+	}
+
+	if cfg.pprofEnabled {
+		r.Mount("/debug", middleware.Profiler())
+	}
+}
+
+// newAdminRouter returns the router for operational endpoints mounted under /admin.
+// These endpoints expose internal detail and must only be enabled via ADMIN_ENABLED.
+// Only clients connecting from allowedIPs may reach them. Recent errors are listed when recent isn't nil.
+func newAdminRouter(drain *drainState, ready *readiness, recent *recentErrors, allowedIPs []netip.Prefix) chi.Router {
+	r := chi.NewRouter()
+	r.Use(allowIPs(allowedIPs))
+
+	r.Get("/shutdown-status", drain.ServeHTTP)
+	r.Get("/readyz", ready.serveDeep)
+
+	if recent != nil {
+		r.Get("/errors", recent.ServeHTTP)
+	}
+
+	r.Post("/gc", handler(func(w http.ResponseWriter, r *http.Request) error {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		start := time.Now()
+		// FreeOSMemory runs a collection before returning freed memory to the OS
+		debug.FreeOSMemory()
+		took := time.Since(start)
+
+		runtime.ReadMemStats(&after)
+
+		return encode(w, r, http.StatusOK, gcResponse{
+			Before:   newHeapStats(&before),
+			After:    newHeapStats(&after),
+			Duration: took.String(),
+		})
+	}))
+
+	r.Get("/goroutines", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(goroutineDump())
+	})
+
+	return r
+}
+
+// allowIPs responds 403 to requests whose connection doesn't come from allowed. The connection's address is
+// used rather than one resolved from proxy headers, since ops routes are mounted outside of trustProxy.
+func allowIPs(allowed []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, err := isTrustedIP(r.RemoteAddr, allowed); err != nil || !ok {
+				writeProblem(w, r, http.StatusForbidden, "client address not allowed")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type gcResponse struct {
+	Before   heapStats `json:"before"`
+	After    heapStats `json:"after"`
+	Duration string    `json:"duration"`
+}
+
+// heapStats is the subset of runtime.MemStats relevant to comparing the heap around a collection.
+type heapStats struct {
+	HeapAlloc    uint64 `json:"heapAlloc"`
+	HeapInuse    uint64 `json:"heapInuse"`
+	HeapIdle     uint64 `json:"heapIdle"`
+	HeapReleased uint64 `json:"heapReleased"`
+	HeapObjects  uint64 `json:"heapObjects"`
+	Sys          uint64 `json:"sys"`
+	NumGC        uint32 `json:"numGC"`
+}
+
+func newHeapStats(m *runtime.MemStats) heapStats {
+	return heapStats{
+		HeapAlloc:    m.HeapAlloc,
+		HeapInuse:    m.HeapInuse,
+		HeapIdle:     m.HeapIdle,
+		HeapReleased: m.HeapReleased,
+		HeapObjects:  m.HeapObjects,
+		Sys:          m.Sys,
+		NumGC:        m.NumGC,
+	}
+}
+
+// goroutineDump returns the stack traces of all goroutines.
+func goroutineDump() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// logGoroutinesOnSignal logs a full goroutine dump whenever goroutineDumpSignal is received.
+// It is a no-op on platforms without a dump signal.
+func logGoroutinesOnSignal(logger *slog.Logger) {
+	if goroutineDumpSignal == nil {
+		return
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, goroutineDumpSignal)
+
+	go func() {
+		for sig := range sigs {
+			logger.Info("Goroutine dump", slog.String("signal", sig.String()), slog.String("stack", string(goroutineDump())))
+		}
+	}()
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// parseAllowedHosts parses a comma separated list of host names, where a leading `*.` matches any subdomain,
+// e.g. `*.example.com` matches `api.example.com` and `a.b.example.com` but not `example.com` itself.
+func parseAllowedHosts(value string) ([]string, error) {
+	hosts, _ := parseStringSlice(value)
+
+	for i, host := range hosts {
+		pattern := strings.TrimPrefix(host, "*.")
+		if pattern == "" || strings.ContainsAny(pattern, "*:/") {
+			return nil, fmt.Errorf("invalid allowed host %q: must be a host name without a port, optionally prefixed with *.", host)
+		}
+
+		hosts[i] = normalizeHost(host)
+	}
+
+	return hosts, nil
+}
+
+// allowHosts rejects requests whose host isn't one of hosts with a 421, so that a forged Host header can't
+// make the service generate links to or poison caches for hosts it doesn't serve. Behind a trusted proxy the
+// host is the one resolved by trustProxy from X-Forwarded-Host. Requests for skipPaths, such as probes sent
+// to the pod's address, are passed through untouched.
+func allowHosts(hosts []string, skipPaths ...string) func(http.Handler) http.Handler {
+	allowed := func(host string) bool {
+		return slices.ContainsFunc(hosts, func(pattern string) bool {
+			if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+				return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+			}
+			return host == pattern
+		})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if slices.Contains(skipPaths, r.URL.Path) || allowed(normalizeHost(r.Host)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			writeProblem(w, r, http.StatusMisdirectedRequest, "host not allowed")
+		})
+	}
+}
+
+// normalizeHost lowercases host and strips its port and any trailing dot, so that `Example.com.:443`
+// compares equal to `example.com`.
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
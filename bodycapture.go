@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// redacted replaces the values of sensitive fields in captured bodies.
+const redacted = "[REDACTED]"
+
+// bodyCapture keeps up to max bytes of what the handler reads from a request body, so that the body of a
+// failed request can be logged. Bytes the handler never reads aren't captured.
+type bodyCapture struct {
+	io.ReadCloser
+	mediaType string
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+// newBodyCapture captures up to maxBytes of rc when contentType is JSON or a URL encoded form, the bodies that can be redacted,
+// and returns nil otherwise.
+func newBodyCapture(rc io.ReadCloser, contentType string, maxBytes int64) *bodyCapture {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || !(isJSONMediaType(mediaType) || mediaType == "application/x-www-form-urlencoded") {
+		return nil
+	}
+
+	return &bodyCapture{ReadCloser: rc, mediaType: mediaType, max: int(maxBytes)}
+}
+
+func (c *bodyCapture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+
+	room := c.max - c.buf.Len()
+	if n > room {
+		c.truncated = true
+	}
+	c.buf.Write(p[:min(n, max(room, 0))])
+
+	return n, err
+}
+
+// attrs returns the captured body, with the values of fields named in redactKeys replaced, as log attributes.
+// It returns none when nothing was read.
+func (c *bodyCapture) attrs(redactKeys []string) []slog.Attr {
+	if c.buf.Len() == 0 {
+		return nil
+	}
+
+	var body string
+	if isJSONMediaType(c.mediaType) {
+		body = redactJSON(c.buf.Bytes(), redactKeys)
+	} else {
+		body = redactForm(c.buf.String(), redactKeys)
+	}
+
+	attrs := []slog.Attr{slog.String("requestBody", body)}
+	if c.truncated {
+		attrs = append(attrs, slog.Bool("requestBodyTruncated", true))
+	}
+
+	return attrs
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func sensitiveKey(keys []string, key string) bool {
+	return slices.ContainsFunc(keys, func(k string) bool {
+		return strings.EqualFold(k, key)
+	})
+}
+
+// redactJSON redacts the values of object fields named in keys at any depth. Bodies that don't parse, such as
+// truncated ones, are redacted textually, which catches fields whose value was captured in full.
+func redactJSON(body []byte, keys []string) string {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return redactJSONText(string(body), keys)
+	}
+
+	b, err := json.Marshal(redactJSONValue(v, keys))
+	if err != nil {
+		return redactJSONText(string(body), keys)
+	}
+
+	return string(b)
+}
+
+func redactJSONValue(v any, keys []string) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, val := range v {
+			if sensitiveKey(keys, k) {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSONValue(val, keys)
+			}
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = redactJSONValue(val, keys)
+		}
+	}
+
+	return v
+}
+
+// jsonField matches an object field name and its value when the value is a string or a literal.
+var jsonField = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|[\w.+-]*)`)
+
+func redactJSONText(body string, keys []string) string {
+	return jsonField.ReplaceAllStringFunc(body, func(field string) string {
+		m := jsonField.FindStringSubmatch(field)
+		if !sensitiveKey(keys, m[1]) {
+			return field
+		}
+
+		return `"` + m[1] + `"` + m[2] + `"` + redacted + `"`
+	})
+}
+
+// redactForm redacts the values of form fields named in keys. A body truncated within a field still parses,
+// with the field's value cut short.
+func redactForm(body string, keys []string) string {
+	values, err := url.ParseQuery(body)
+	if err != nil {
+		return redacted
+	}
+
+	for k := range values {
+		if sensitiveKey(keys, k) {
+			values[k] = []string{redacted}
+		}
+	}
+
+	return values.Encode()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// rejectOversizedBody responds 413 to requests declaring a Content-Length above maxBytes without reading the body.
+// net/http only replies `100 Continue` to `Expect: 100-continue` requests once a handler reads the body,
+// so such clients are rejected before uploading anything. Bodies of unknown length are still bounded
+// by the http.MaxBytesReader installed by the logging middleware.
+func rejectOversizedBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				writeProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body of %d bytes exceeds the maximum of %d bytes", r.ContentLength, maxBytes))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// limitedBody wraps a http.MaxBytesReader, recording whether a read went past the limit.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func newLimitedBody(w http.ResponseWriter, rc io.ReadCloser, maxBytes int64) *limitedBody {
+	return &limitedBody{ReadCloser: http.MaxBytesReader(w, rc, maxBytes)}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+
+	return n, err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// bodyReadTimeout gives clients timeout to send the whole request body by setting a read deadline on the
+// connection, so that a client trickling its body can't hold the connection open indefinitely. Reading
+// the body past the deadline fails with an error wrapping os.ErrDeadlineExceeded.
+//
+// The deadline is cleared once the body has been read, so that handlers taking longer than timeout to
+// respond are unaffected, and requests whose connection doesn't support deadlines are passed through.
+func bodyReadTimeout(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if timeout <= 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rc := http.NewResponseController(w)
+			if err := rc.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// an expired deadline left on the connection would make net/http consider it closed
+			// and cancel the request context once the handler stops reading the body
+			clearDeadline := sync.OnceFunc(func() { rc.SetReadDeadline(time.Time{}) })
+			defer clearDeadline()
+
+			r.Body = &deadlineBody{ReadCloser: r.Body, clear: clearDeadline}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// deadlineBody clears the connection's read deadline once the body has been read in full.
+type deadlineBody struct {
+	io.ReadCloser
+	clear func()
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, io.EOF) {
+		b.clear()
+	}
+
+	return n, err
+}
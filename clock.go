@@ -0,0 +1,16 @@
+package main
+
+import "time"
+
+// clock tells the time. Middleware measuring durations or refilling limits take a clock instead of calling
+// time.Now directly, so that time can be controlled when exercising them.
+type clock interface {
+	Now() time.Time
+}
+
+// systemClock is the clock used in production, backed by time.Now.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// coalesce shares a single response between concurrent identical GET and HEAD requests so that an expensive
+// read is computed once rather than by each of them. Requests are identical when their method, path, query,
+// and Accept header match. Other methods are passed through.
+//
+// Only apply this to routes whose responses don't depend on who is asking: the response computed for one
+// client, headers included, is served to all of them. The handler runs with a copy of the first request whose
+// context isn't canceled with it, so that the other requests still get a response. Each request stops waiting
+// once its own context is done. Fields the handler adds to the access log line are added to the line of each
+// request it answers.
+func coalesce() func(http.Handler) http.Handler {
+	var group singleflight.Group
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := r.Method + " " + r.URL.RequestURI() + " " + r.Header.Get("Accept")
+			ch := group.DoChan(key, func() (v any, err error) {
+				rec := &recordedResponse{header: http.Header{}, status: http.StatusOK, fields: &logFields{}}
+
+				// a panic would otherwise crash the process from singleflight's goroutine
+				defer func() {
+					if p := recover(); p != nil {
+						err = &coalescedPanic{value: p}
+					}
+				}()
+
+				ctx := context.WithoutCancel(r.Context())
+				if deadline, ok := r.Context().Deadline(); ok {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithDeadline(ctx, deadline)
+					defer cancel()
+				}
+
+				// the first request may stop waiting while the handler still runs, so the handler gets a request of
+				// its own, with its own log fields, rather than sharing the first request's state
+				ctx = context.WithValue(ctx, ctxKeyLogFields, rec.fields)
+				next.ServeHTTP(rec, r.Clone(ctx))
+
+				return rec, nil
+			})
+
+			select {
+			case res := <-ch:
+				if p, ok := res.Err.(*coalescedPanic); ok {
+					// re-panic in the request's goroutine for the recoverer to handle
+					panic(p.value)
+				}
+
+				rec := res.Val.(*recordedResponse)
+				rec.addLogFieldsTo(r)
+				rec.writeTo(w)
+			case <-r.Context().Done():
+			}
+		})
+	}
+}
+
+type coalescedPanic struct {
+	value any
+}
+
+func (p *coalescedPanic) Error() string {
+	return "panic in coalesced handler"
+}
+
+// recordedResponse is an http.ResponseWriter recording a response so that it can be written to several clients.
+// fields collects what the handler attached to the access log line, to be copied onto each request served.
+type recordedResponse struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	fields      *logFields
+}
+
+func (rr *recordedResponse) Header() http.Header {
+	return rr.header
+}
+
+func (rr *recordedResponse) WriteHeader(status int) {
+	if rr.wroteHeader {
+		return
+	}
+
+	rr.status = status
+	rr.wroteHeader = true
+}
+
+func (rr *recordedResponse) Write(p []byte) (int, error) {
+	rr.wroteHeader = true
+	return rr.body.Write(p)
+}
+
+// addLogFieldsTo adds the log fields recorded by the handler to the access log line of r.
+// It may be called concurrently, since the recorded fields are only read once the handler returned.
+func (rr *recordedResponse) addLogFieldsTo(r *http.Request) {
+	addLogField(r, rr.fields.attrs...)
+	if rr.fields.status != 0 {
+		setLogStatus(r, rr.fields.status)
+	}
+	if rr.fields.err != "" {
+		setResponseError(r, rr.fields.err)
+	}
+}
+
+// writeTo writes the recorded response to w. It may be called concurrently.
+func (rr *recordedResponse) writeTo(w http.ResponseWriter) error {
+	for name, values := range rr.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+
+	w.WriteHeader(rr.status)
+	_, err := w.Write(rr.body.Bytes())
+
+	return err
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// coalescedRequest is a request served through coalesce along with its own log fields and response.
+type coalescedRequest struct {
+	r      *http.Request
+	w      *httptest.ResponseRecorder
+	fields *logFields
+	done   chan struct{}
+}
+
+func serveCoalesced(h http.Handler, ctx context.Context) *coalescedRequest {
+	fields := &logFields{}
+	cr := &coalescedRequest{
+		r:      withRequestLogging(httptest.NewRequest(http.MethodGet, "/report", nil).WithContext(ctx), slog.Default(), "id", fields),
+		w:      httptest.NewRecorder(),
+		fields: fields,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(cr.done)
+		h.ServeHTTP(cr.w, cr.r)
+	}()
+
+	return cr
+}
+
+func TestCoalesce(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	h := coalesce()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		close(started)
+		<-release
+
+		// added once the first request may have stopped waiting
+		addLogField(r, slog.String("report", "r1"))
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("report"))
+	}))
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	defer cancelLeader()
+
+	leader := serveCoalesced(h, leaderCtx)
+	<-started
+
+	var followers []*coalescedRequest
+	for i := 0; i < 5; i++ {
+		followers = append(followers, serveCoalesced(h, context.Background()))
+	}
+	// give the followers time to join the call in flight, which isn't observable
+	time.Sleep(50 * time.Millisecond)
+
+	// the first request goes away while the handler still runs
+	cancelLeader()
+	<-leader.done
+	close(release)
+
+	var wg sync.WaitGroup
+	for _, f := range followers {
+		wg.Add(1)
+		go func(f *coalescedRequest) {
+			defer wg.Done()
+			<-f.done
+		}(f)
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d handler calls, want 1", n)
+	}
+
+	if leader.w.Body.Len() != 0 || len(leader.fields.attrs) != 0 {
+		t.Errorf("got response %q and log fields %v for the canceled request, want none", leader.w.Body.String(), leader.fields.attrs)
+	}
+
+	for i, f := range followers {
+		if f.w.Code != http.StatusAccepted || f.w.Body.String() != "report" || f.w.Header().Get("Content-Type") != "text/plain" {
+			t.Errorf("request %d: got %d %q with headers %v, want the shared response", i, f.w.Code, f.w.Body.String(), f.w.Header())
+		}
+
+		if len(f.fields.attrs) != 1 || f.fields.attrs[0].String() != "report=r1" {
+			t.Errorf("request %d: got log fields %v, want the handler's", i, f.fields.attrs)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	encodingBrotli   = "br"
+	encodingGzip     = "gzip"
+	encodingDeflate  = "deflate"
+	encodingIdentity = "identity"
+)
+
+// compressor is implemented by the brotli, gzip, and zlib writers. The deflate content coding is the zlib
+// format rather than raw deflate.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+var compressorPools = map[string]*sync.Pool{
+	encodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	encodingGzip: {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+	encodingDeflate: {New: func() any {
+		return zlib.NewWriter(nil)
+	}},
+}
+
+// compress compresses responses with the first of encodings, in order of preference, that the client
+// accepts with the highest quality, unless the response's Content-Type matches one of skipContentTypes.
+// Patterns ending in `*` match by prefix, e.g. `image/*`, others match the media type exactly. Responses
+// already carrying a Content-Encoding are left untouched. Requests accepting neither one of encodings nor
+// uncompressed responses, e.g. with `Accept-Encoding: zstd, identity;q=0`, are answered with a 406.
+func compress(encodings []string, skipContentTypes []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding, ok := negotiateEncoding(r.Header.Get("Accept-Encoding"), encodings)
+			if !ok {
+				writeProblem(w, r, http.StatusNotAcceptable, fmt.Sprintf("no acceptable content coding, available: %s", strings.Join(append(slices.Clip(encodings), encodingIdentity), ", ")))
+				return
+			}
+
+			if encoding == encodingIdentity {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, encoding: encoding, skipContentTypes: skipContentTypes}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding returns the one of encodings the Accept-Encoding header value allows with the highest
+// quality, ties going to the earliest in encodings, or identity when the response should not be compressed.
+// Codings not listed in the header take the quality of `*`, if present. Uncompressed responses are acceptable
+// unless excluded with `identity;q=0`, or `*;q=0` without an identity entry, and are only preferred over a
+// compressed one when identity is listed with a higher quality. It returns false when no coding is acceptable.
+func negotiateEncoding(acceptEncoding string, encodings []string) (string, bool) {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+
+		qualities[coding] = parseQuality(params)
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q = qualities["*"]
+		}
+
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	// identity only competes with the offered codings when listed, and is the fallback otherwise
+	identityQ, listed := qualities[encodingIdentity]
+	if !listed {
+		identityQ = 1
+		if q, ok := qualities["*"]; ok && q == 0 {
+			identityQ = 0
+		}
+	}
+
+	if best == "" || (listed && identityQ > bestQ) {
+		return encodingIdentity, identityQ > 0
+	}
+
+	return best, true
+}
+
+// parseQuality returns the value of the q parameter among the parameters of an Accept-Encoding entry,
+// defaulting to 1. Malformed values are treated as 0 and others are clamped between 0 and 1.
+func parseQuality(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+			continue
+		}
+
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsNaN(q) {
+			return 0
+		}
+
+		return min(max(q, 0), 1)
+	}
+
+	return 1
+}
+
+// parseCompressionEncodings parses a comma separated list of content codings offered by compress,
+// in order of preference.
+func parseCompressionEncodings(value string) ([]string, error) {
+	encodings, err := parseStringSlice(value)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, encoding := range encodings {
+		encoding = strings.ToLower(encoding)
+		if _, ok := compressorPools[encoding]; !ok {
+			return nil, fmt.Errorf("invalid compression encoding %q: must be one of %s, %s, or %s", encoding, encodingBrotli, encodingGzip, encodingDeflate)
+		}
+		encodings[i] = encoding
+	}
+
+	return encodings, nil
+}
+
+// compressWriter decides whether to compress once the response's status and headers are known.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding         string
+	skipContentTypes []string
+	enc              compressor
+	wroteHeader      bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	if status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && !cw.skipped(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		// the compressed body differs byte for byte from the one a strong ETag was computed from
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		cw.enc = compressorPools[cw.encoding].Get().(compressor)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		// as net/http would, so that the sniffed content type can be checked against the skip list
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *compressWriter) skipped(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range cw.skipContentTypes {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if len(mediaType) >= len(prefix) && strings.EqualFold(mediaType[:len(prefix)], prefix) {
+				return true
+			}
+		} else if strings.EqualFold(mediaType, pattern) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cw *compressWriter) Flush() {
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := cw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking connection: response writer does not support hijacking")
+	}
+
+	return hj.Hijack()
+}
+
+func (cw *compressWriter) close() {
+	if cw.enc == nil {
+		return
+	}
+
+	cw.enc.Close()
+	cw.enc.Reset(nil)
+	compressorPools[cw.encoding].Put(cw.enc)
+}
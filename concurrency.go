@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// concurrencyLimiter caps the number of requests handled at once across all clients. Requests over the limit
+// wait in a queue of bounded length for a slot to free up, so that short bursts are absorbed while sustained
+// overload is turned away instead of piling up latency and memory.
+type concurrencyLimiter struct {
+	slots     chan struct{}
+	maxQueue  int64
+	queued    atomic.Int64
+	clk       clock
+	rejected  metric.Int64Counter
+	abandoned metric.Int64Counter
+}
+
+// errRequestQueueFull is returned by concurrencyLimiter.acquire when no slot is free and the queue is full.
+var errRequestQueueFull = errors.New("request queue full")
+
+// newConcurrencyLimiter returns a concurrencyLimiter handling limit requests at once with up to maxQueue
+// requests waiting. Rejections are counted by rejected, requests whose client disconnected while queued by
+// abandoned, and the queue depth is reported by a gauge.
+func newConcurrencyLimiter(limit, maxQueue int, clk clock, rejected, abandoned metric.Int64Counter) (*concurrencyLimiter, error) {
+	l := &concurrencyLimiter{
+		slots:     make(chan struct{}, limit),
+		maxQueue:  int64(maxQueue),
+		clk:       clk,
+		rejected:  rejected,
+		abandoned: abandoned,
+	}
+
+	_, err := otel.Meter(instrumentationName).Int64ObservableGauge(
+		"http_request_queue_depth",
+		metric.WithDescription("Number of requests waiting for the concurrency limiter"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(l.queued.Load())
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, errWrap(err, "creating request queue depth gauge")
+	}
+
+	return l, nil
+}
+
+// acquire takes a slot, waiting in the queue when none is free, and returns how long it waited. It fails
+// with errRequestQueueFull when the queue is full, and with ctx's error when ctx is done while waiting.
+func (l *concurrencyLimiter) acquire(ctx context.Context) (time.Duration, error) {
+	select {
+	case l.slots <- struct{}{}:
+		return 0, nil
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueue {
+		l.queued.Add(-1)
+		return 0, errRequestQueueFull
+	}
+	defer l.queued.Add(-1)
+
+	start := l.clk.Now()
+	select {
+	case l.slots <- struct{}{}:
+		return l.clk.Now().Sub(start), nil
+	case <-ctx.Done():
+		return l.clk.Now().Sub(start), ctx.Err()
+	}
+}
+
+func (l *concurrencyLimiter) release() {
+	<-l.slots
+}
+
+// middleware rejects requests with a 503 when the queue is full or their deadline passes before a slot frees
+// up. Requests whose client disconnects while queued are abandoned instead, see skipAbandoned. The time each
+// request waited is logged as queueWait.
+func (l *concurrencyLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wait, err := l.acquire(r.Context())
+		addLogField(r, slog.Duration("queueWait", wait))
+		if errors.Is(err, context.Canceled) {
+			markAbandoned(r, l.abandoned)
+			return
+		}
+		if err != nil {
+			recordRejection(r, l.rejected, "concurrency")
+			writeProblem(w, r, http.StatusServiceUnavailable, "server is at capacity")
+			return
+		}
+		defer l.release()
+
+		next.ServeHTTP(w, r)
+	})
+}
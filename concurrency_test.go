@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// newTestCounter returns a counter recorded in memory along with a function summing what it counted.
+func newTestCounter(t *testing.T, name string) (metric.Int64Counter, func() int64) {
+	t.Helper()
+
+	reader := sdkmetric.NewManualReader()
+	counter, err := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)).Meter("test").Int64Counter(name)
+	if err != nil {
+		t.Fatalf("creating counter: %v", err)
+	}
+
+	return counter, func() int64 {
+		var rm metricdata.ResourceMetrics
+		if err := reader.Collect(context.Background(), &rm); err != nil {
+			t.Fatalf("collecting metrics: %v", err)
+		}
+
+		var sum int64
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if data, ok := m.Data.(metricdata.Sum[int64]); ok {
+					for _, dp := range data.DataPoints {
+						sum += dp.Value
+					}
+				}
+			}
+		}
+
+		return sum
+	}
+}
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	tests := []struct {
+		name string
+		// wait gives up on the queued request, by canceling its context or letting its deadline pass
+		wait          func(cancel context.CancelFunc)
+		timeout       time.Duration
+		wantStatus    int
+		wantWritten   bool
+		wantRejected  int64
+		wantAbandoned int64
+	}{
+		{
+			name:          "client disconnects",
+			wait:          func(cancel context.CancelFunc) { cancel() },
+			wantStatus:    statusClientClosedRequest,
+			wantWritten:   false,
+			wantAbandoned: 1,
+		},
+		{
+			name:         "deadline passes",
+			wait:         func(context.CancelFunc) {},
+			timeout:      10 * time.Millisecond,
+			wantStatus:   http.StatusServiceUnavailable,
+			wantWritten:  true,
+			wantRejected: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected, countRejected := newTestCounter(t, "rejected")
+			abandoned, countAbandoned := newTestCounter(t, "abandoned")
+
+			l, err := newConcurrencyLimiter(1, 1, systemClock{}, rejected, abandoned)
+			if err != nil {
+				t.Fatalf("creating concurrency limiter: %v", err)
+			}
+
+			release := make(chan struct{})
+			var handled atomic.Int32
+			h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handled.Add(1)
+				<-release
+			}))
+
+			// the first request holds the only slot until released
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			}()
+			t.Cleanup(func() {
+				close(release)
+				<-done
+			})
+			for len(l.slots) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.timeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			fields := &logFields{}
+			r := withRequestLogging(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx), slog.Default(), "id", fields)
+			w := httptest.NewRecorder()
+
+			queued := make(chan struct{})
+			go func() {
+				defer close(queued)
+				h.ServeHTTP(w, r)
+			}()
+			for l.queued.Load() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			tt.wait(cancel)
+			<-queued
+
+			if n := handled.Load(); n != 1 {
+				t.Errorf("got %d handled requests, want only the first", n)
+			}
+			if status := fields.statusOr(w.Code); status != tt.wantStatus {
+				t.Errorf("got logged status %d, want %d", status, tt.wantStatus)
+			}
+			if written := w.Body.Len() > 0; written != tt.wantWritten {
+				t.Errorf("got response written: %t, want %t", written, tt.wantWritten)
+			}
+			if n := countRejected(); n != tt.wantRejected {
+				t.Errorf("got %d rejections, want %d", n, tt.wantRejected)
+			}
+			if n := countAbandoned(); n != tt.wantAbandoned {
+				t.Errorf("got %d abandoned requests, want %d", n, tt.wantAbandoned)
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log/slog"
+	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/go-units"
@@ -18,9 +22,94 @@ type config struct {
 	shutdownTimeout          time.Duration
 	serviceName              string
 	serviceVersion           string
+	serviceInstanceID        string
 	otelEnabled              bool
 	otelExporterOTLPEndpoint *url.URL
+	otelHealthCheckRequired  bool
 	maxAllowedRequestBytes   int64
+	requestIDAcceptAny       bool
+	requestIDGenerator       string
+	logBaggageKeys           []string
+	adminEnabled             bool
+	pprofEnabled             bool
+	adminPort                int
+	requiredContentTypes     []string
+	maxURLLength             int64
+	maxQueryLength           int64
+	templatesDir             string
+	maxHeaderBytes           int64
+	rateLimitRPS             float64
+	rateLimitBurst           int
+	rateLimitKey             string
+	otelShutdownTimeout      time.Duration
+	otelSetupTimeout         time.Duration
+	otelFailOpen             bool
+	requestTimeout           time.Duration
+	accessLogFile            string
+	shutdownDrainDelay       time.Duration
+	shutdownDrainJitter      time.Duration
+	auditEnabled             bool
+	metricsEnabled           bool
+	httpsRedirect            bool
+	httpsRequire             bool
+	maxConnections           int
+	featureFlags             map[string]bool
+	trustedProxies           []netip.Prefix
+	trustedProxyHopCount     int
+	readinessCacheInterval   time.Duration
+	gzipEnabled              bool
+	gzipSkipContentTypes     []string
+	compressionEncodings     []string
+	trailingSlash            string
+	maxRequestsBeforeRestart int
+	openAPISpecPath          string
+	swaggerUIEnabled         bool
+	servedByEnabled          bool
+	workerPoolSize           int
+	workerPoolQueueSize      int
+	tlsCertFile              string
+	tlsKeyFile               string
+	bodyReadTimeout          time.Duration
+	responseEnvelope         bool
+	maxAcceptsPerSecond      float64
+	maxAcceptsBurst          int
+	logTLSInfo               bool
+	reusePort                bool
+	propagateHeaders         []string
+	multipartMaxFields       int
+	multipartMaxFiles        int
+	multipartMaxFieldBytes   int64
+	corsAllowedOrigins       []string
+	corsAllowedMethods       []string
+	corsAllowedHeaders       []string
+	corsMaxAge               time.Duration
+	rateLimitIdleTTL         time.Duration
+	rateLimitMaxKeys         int
+	trustProxyEnabled        bool
+	debugEchoEnabled         bool
+	debugEchoSecret          string
+	adminAllowedIPs          []netip.Prefix
+	maxInFlightPerIP         int
+	logFormat                string
+	maxResponseHeaderBytes   int64
+	disabledMiddleware       map[string]bool
+	tempDir                  string
+	tempDirMinFreeBytes      int64
+	allowedHosts             []string
+	otelSampleRatio          float64
+	otelSlowRequestThreshold time.Duration
+	captureBodyOnError       bool
+	captureBodyMaxBytes      int64
+	captureBodyRedactKeys    []string
+	proxyProfile             string
+	proxyHeaders             proxyHeaders
+	requestIDMaxLength       int
+	recentErrorsSize         int
+	errorCatalogFile         string
+	errorDefaultLocale       string
+	concurrencyLimit         int
+	concurrencyMaxQueue      int
+	logTTFB                  bool
 }
 
 func newConfig() (*config, error) {
@@ -31,7 +120,7 @@ func newConfig() (*config, error) {
 		errs = append(errs, err)
 	}
 
-	healthEndpoint, err := getEnv("HEALTH_ENDPOINT", parseString, "/health")
+	healthEndpoint, err := getEnvOptional("HEALTH_ENDPOINT", parseString, "/health")
 	if err != nil {
 		errs = append(errs, err)
 	}
@@ -46,12 +135,17 @@ func newConfig() (*config, error) {
 		errs = append(errs, err)
 	}
 
-	serviceName, err := getEnv("SERVICE_NAME", parseString, "go-chi")
+	serviceName, err := getEnvOptional("SERVICE_NAME", parseString, "go-chi")
 	if err != nil {
 		errs = append(errs, err)
 	}
 
-	serviceVersion, err := getEnv("SERVICE_VERSION", parseString, "v1.0.0")
+	serviceVersion, err := getEnvOptional("SERVICE_VERSION", parseString, "v1.0.0")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	serviceInstanceID, err := getEnvOptional("SERVICE_INSTANCE_ID", parseString, "")
 	if err != nil {
 		errs = append(errs, err)
 	}
@@ -61,7 +155,12 @@ func newConfig() (*config, error) {
 		errs = append(errs, err)
 	}
 
-	otelExporterOTLPEndpoint, err := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", url.Parse, nil)
+	otelExporterOTLPEndpoint, err := getEnvOptional("OTEL_EXPORTER_OTLP_ENDPOINT", parseAbsoluteURL, nil)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	otelHealthCheckRequired, err := getEnv("OTEL_HEALTH_CHECK_REQUIRED", strconv.ParseBool, false)
 	if err != nil {
 		errs = append(errs, err)
 	}
@@ -71,6 +170,464 @@ func newConfig() (*config, error) {
 		errs = append(errs, err)
 	}
 
+	requestIDAcceptAny, err := getEnv("REQUEST_ID_ACCEPT_ANY", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	requestIDGenerator, err := getEnvOptional("REQUEST_ID_GENERATOR", parseRequestIDGenerator, requestIDGeneratorUUID)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	logBaggageKeys, err := getEnvOptional("LOG_BAGGAGE_KEYS", parseStringSlice, nil)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	adminEnabled, err := getEnv("ADMIN_ENABLED", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	pprofEnabled, err := getEnv("PPROF_ENABLED", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	adminPort, err := getEnv("ADMIN_PORT", strconv.Atoi, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	requiredContentTypes, err := getEnv("REQUIRED_CONTENT_TYPES", parseStringSlice, []string{"application/json"})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	maxURLLength, err := getEnv("MAX_URL_LENGTH", units.FromHumanSize, int64(8*1024))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	maxQueryLength, err := getEnv("MAX_QUERY_LENGTH", units.FromHumanSize, int64(8*1024))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	templatesDir, err := getEnvOptional("TEMPLATES_DIR", parseString, "")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	maxHeaderBytes, err := getEnv("MAX_HEADER_BYTES", units.FromHumanSize, int64(http.DefaultMaxHeaderBytes))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rateLimitRPS, err := getEnv("RATE_LIMIT_RPS", parseFloat, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rateLimitBurst, err := getEnv("RATE_LIMIT_BURST", parsePositiveInt, 10)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rateLimitKey, err := getEnvOptional("RATE_LIMIT_KEY", parseRateLimitKey, rateLimitKeyIP)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	otelShutdownTimeout, err := getEnv("OTEL_SHUTDOWN_TIMEOUT", parseDuration, time.Second*5)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	otelSetupTimeout, err := getEnv("OTEL_SETUP_TIMEOUT", parsePositiveDuration, time.Second*5)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	otelFailOpen, err := getEnv("OTEL_FAIL_OPEN", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	requestTimeout, err := getEnv("REQUEST_TIMEOUT", parseDuration, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	accessLogFile, err := getEnvOptional("ACCESS_LOG_FILE", parseString, "")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	shutdownDrainDelay, err := getEnv("SHUTDOWN_DRAIN_DELAY", parseDuration, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	shutdownDrainJitter, err := getEnv("SHUTDOWN_DRAIN_JITTER", parseDuration, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	auditEnabled, err := getEnv("AUDIT_ENABLED", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	metricsEnabled, err := getEnv("METRICS_ENABLED", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	httpsRedirect, err := getEnv("HTTPS_REDIRECT", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	httpsRequire, err := getEnv("HTTPS_REQUIRE", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	maxConnections, err := getEnv("MAX_CONNECTIONS", strconv.Atoi, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	featureFlags, err := getEnvOptional("FEATURE_FLAGS", parseFeatureFlags, nil)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	trustedProxies, err := getEnv("TRUSTED_PROXIES", parseTrustedProxies, parsedTrustedIPs)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	trustedProxyHopCount, err := getEnv("TRUSTED_PROXY_HOP_COUNT", strconv.Atoi, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	readinessCacheInterval, err := getEnv("READINESS_CACHE_INTERVAL", parsePositiveDuration, time.Second*10)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	gzipEnabled, err := getEnv("GZIP_ENABLED", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	gzipSkipContentTypes, err := getEnv("GZIP_SKIP_CONTENT_TYPES", parseStringSlice, []string{
+		"image/*",
+		"video/*",
+		"audio/*",
+		"font/woff",
+		"font/woff2",
+		"application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/zstd",
+		"application/x-7z-compressed",
+		"application/x-rar-compressed",
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	compressionEncodings, err := getEnvOptional("COMPRESSION_ENCODINGS", parseCompressionEncodings, []string{encodingBrotli, encodingGzip})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	trailingSlash, err := getEnvOptional("TRAILING_SLASH", parseTrailingSlash, trailingSlashExact)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	maxRequestsBeforeRestart, err := getEnv("MAX_REQUESTS_BEFORE_RESTART", strconv.Atoi, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	openAPISpecPath, err := getEnvOptional("OPENAPI_SPEC_PATH", parseString, "")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	swaggerUIEnabled, err := getEnv("SWAGGER_UI_ENABLED", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	servedByEnabled, err := getEnv("SERVED_BY_HEADER_ENABLED", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	workerPoolSize, err := getEnv("WORKER_POOL_SIZE", parsePositiveInt, 4)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	workerPoolQueueSize, err := getEnv("WORKER_POOL_QUEUE_SIZE", parsePositiveInt, 100)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	tlsCertFile, err := getEnvOptional("TLS_CERT_FILE", parseString, "")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	tlsKeyFile, err := getEnvOptional("TLS_KEY_FILE", parseString, "")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if (tlsCertFile == "") != (tlsKeyFile == "") {
+		errs = append(errs, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together"))
+	}
+
+	bodyReadTimeout, err := getEnv("BODY_READ_TIMEOUT", parseDuration, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	responseEnvelope, err := getEnv("RESPONSE_ENVELOPE", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	maxAcceptsPerSecond, err := getEnv("MAX_ACCEPTS_PER_SECOND", parseNonNegativeFloat, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	maxAcceptsBurst, err := getEnv("MAX_ACCEPTS_BURST", parsePositiveInt, 10)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	logTLSInfo, err := getEnv("LOG_TLS_INFO", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	reusePort, err := getEnv("REUSE_PORT", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	propagateHeaders, err := getEnvOptional("PROPAGATE_HEADERS", parseStringSlice, nil)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	multipartMaxFields, err := getEnv("MULTIPART_MAX_FIELDS", parsePositiveInt, 1000)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	multipartMaxFiles, err := getEnv("MULTIPART_MAX_FILES", parsePositiveInt, 100)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	multipartMaxFieldBytes, err := getEnv("MULTIPART_MAX_FIELD_BYTES", units.FromHumanSize, int64(1000*1000))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	corsAllowedOrigins, err := getEnvOptional("CORS_ALLOWED_ORIGINS", parseStringSlice, nil)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	corsAllowedMethods, err := getEnvOptional("CORS_ALLOWED_METHODS", parseStringSlice, []string{
+		http.MethodGet,
+		http.MethodHead,
+		http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete,
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	corsAllowedHeaders, err := getEnv("CORS_ALLOWED_HEADERS", parseStringSlice, []string{"Content-Type", "Authorization"})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	corsMaxAge, err := getEnv("CORS_MAX_AGE", parseDuration, time.Minute*10)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rateLimitIdleTTL, err := getEnv("RATE_LIMIT_IDLE_TTL", parsePositiveDuration, time.Minute*10)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	rateLimitMaxKeys, err := getEnv("RATE_LIMIT_MAX_KEYS", parsePositiveInt, 100_000)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	trustProxyEnabled, err := getEnvOptional("TRUST_PROXY_ENABLED", strconv.ParseBool, true)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	debugEchoEnabled, err := getEnvOptional("DEBUG_ECHO_REQUEST_INFO", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	debugEchoSecret, err := getEnvOptional("DEBUG_ECHO_SECRET", parseString, "")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if debugEchoEnabled && len(debugEchoSecret) < debugEchoMinSecretLength {
+		errs = append(errs, fmt.Errorf("DEBUG_ECHO_SECRET must be at least %d characters when DEBUG_ECHO_REQUEST_INFO is enabled", debugEchoMinSecretLength))
+	}
+
+	adminAllowedIPs, err := getEnvOptional("ADMIN_ALLOWED_IPS", parseTrustedProxies, parsedTrustedIPs)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	maxInFlightPerIP, err := getEnv("MAX_INFLIGHT_PER_IP", parseNonNegativeInt, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	logFormat, err := getEnvOptional("LOG_FORMAT", parseLogFormat, logFormatJSON)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	maxResponseHeaderBytes, err := getEnv("MAX_RESPONSE_HEADER_BYTES", units.FromHumanSize, int64(0))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	disabledMiddleware, err := getEnvOptional("DISABLE_MIDDLEWARE", parseDisabledMiddleware, map[string]bool{})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	tempDir, err := getEnvOptional("TEMP_DIR", parseString, "")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	tempDirMinFreeBytes, err := getEnv("TEMP_DIR_MIN_FREE_BYTES", units.FromHumanSize, int64(100*1000*1000))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	allowedHosts, err := getEnvOptional("ALLOWED_HOSTS", parseAllowedHosts, nil)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	otelSampleRatio, err := getEnv("OTEL_SAMPLE_RATIO", parseSampleRatio, 1)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	otelSlowRequestThreshold, err := getEnv("OTEL_SLOW_REQUEST_THRESHOLD", parseDuration, time.Second)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	captureBodyOnError, err := getEnvOptional("CAPTURE_BODY_ON_ERROR", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	captureBodyMaxBytes, err := getEnv("CAPTURE_BODY_MAX_BYTES", units.FromHumanSize, int64(4*1000))
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	captureBodyRedactKeys, err := getEnvOptional("CAPTURE_BODY_REDACT_KEYS", parseStringSlice, []string{"password", "secret", "token", "accessToken", "refreshToken", "apiKey", "authorization", "creditCard", "cardNumber", "cvv", "ssn"})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	proxyProfile, err := getEnvOptional("PROXY_PROFILE", parseProxyProfile, proxyProfileGeneric)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	// the individual header lists only apply to the custom profile, defaulting to the generic one
+	proxyHeaders := proxyProfiles[proxyProfile]
+	if proxyProfile == proxyProfileCustom {
+		generic := proxyProfiles[proxyProfileGeneric]
+
+		proxyHeaders.ip, err = getEnv("PROXY_IP_HEADERS", parseStringSlice, generic.ip)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		proxyHeaders.scheme, err = getEnv("PROXY_SCHEME_HEADERS", parseStringSlice, generic.scheme)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		proxyHeaders.host, err = getEnv("PROXY_HOST_HEADERS", parseStringSlice, generic.host)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	requestIDMaxLength, err := getEnv("REQUEST_ID_MAX_LENGTH", parsePositiveInt, 128)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	recentErrorsSize, err := getEnv("RECENT_ERRORS_SIZE", parseNonNegativeInt, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	errorCatalogFile, err := getEnvOptional("ERROR_CATALOG_FILE", parseString, "")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	errorDefaultLocale, err := getEnvOptional("ERROR_DEFAULT_LOCALE", parseLocale, "en")
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	concurrencyLimit, err := getEnv("CONCURRENCY_LIMIT", parseNonNegativeInt, 0)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	concurrencyMaxQueue, err := getEnv("CONCURRENCY_MAX_QUEUE", parseNonNegativeInt, 100)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	logTTFB, err := getEnv("LOG_TTFB", strconv.ParseBool, false)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	if len(errs) > 0 {
 		return nil, errors.Join(errs...)
 	}
@@ -82,9 +639,94 @@ func newConfig() (*config, error) {
 		shutdownTimeout:          shutdownTimeout,
 		serviceName:              serviceName,
 		serviceVersion:           serviceVersion,
+		serviceInstanceID:        serviceInstanceID,
 		otelEnabled:              otelEnabled,
 		otelExporterOTLPEndpoint: otelExporterOTLPEndpoint,
+		otelHealthCheckRequired:  otelHealthCheckRequired,
 		maxAllowedRequestBytes:   maxAllowedRequestBytes,
+		requestIDAcceptAny:       requestIDAcceptAny,
+		requestIDGenerator:       requestIDGenerator,
+		logBaggageKeys:           logBaggageKeys,
+		adminEnabled:             adminEnabled,
+		pprofEnabled:             pprofEnabled,
+		adminPort:                adminPort,
+		requiredContentTypes:     requiredContentTypes,
+		maxURLLength:             maxURLLength,
+		maxQueryLength:           maxQueryLength,
+		templatesDir:             templatesDir,
+		maxHeaderBytes:           maxHeaderBytes,
+		rateLimitRPS:             rateLimitRPS,
+		rateLimitBurst:           rateLimitBurst,
+		rateLimitKey:             rateLimitKey,
+		otelShutdownTimeout:      otelShutdownTimeout,
+		otelSetupTimeout:         otelSetupTimeout,
+		otelFailOpen:             otelFailOpen,
+		requestTimeout:           requestTimeout,
+		accessLogFile:            accessLogFile,
+		shutdownDrainDelay:       shutdownDrainDelay,
+		shutdownDrainJitter:      shutdownDrainJitter,
+		auditEnabled:             auditEnabled,
+		metricsEnabled:           metricsEnabled,
+		httpsRedirect:            httpsRedirect,
+		httpsRequire:             httpsRequire,
+		maxConnections:           maxConnections,
+		featureFlags:             featureFlags,
+		trustedProxies:           trustedProxies,
+		trustedProxyHopCount:     trustedProxyHopCount,
+		readinessCacheInterval:   readinessCacheInterval,
+		gzipEnabled:              gzipEnabled,
+		gzipSkipContentTypes:     gzipSkipContentTypes,
+		compressionEncodings:     compressionEncodings,
+		trailingSlash:            trailingSlash,
+		maxRequestsBeforeRestart: maxRequestsBeforeRestart,
+		openAPISpecPath:          openAPISpecPath,
+		swaggerUIEnabled:         swaggerUIEnabled,
+		servedByEnabled:          servedByEnabled,
+		workerPoolSize:           workerPoolSize,
+		workerPoolQueueSize:      workerPoolQueueSize,
+		tlsCertFile:              tlsCertFile,
+		tlsKeyFile:               tlsKeyFile,
+		bodyReadTimeout:          bodyReadTimeout,
+		responseEnvelope:         responseEnvelope,
+		maxAcceptsPerSecond:      maxAcceptsPerSecond,
+		maxAcceptsBurst:          maxAcceptsBurst,
+		logTLSInfo:               logTLSInfo,
+		reusePort:                reusePort,
+		propagateHeaders:         propagateHeaders,
+		multipartMaxFields:       multipartMaxFields,
+		multipartMaxFiles:        multipartMaxFiles,
+		multipartMaxFieldBytes:   multipartMaxFieldBytes,
+		corsAllowedOrigins:       corsAllowedOrigins,
+		corsAllowedMethods:       corsAllowedMethods,
+		corsAllowedHeaders:       corsAllowedHeaders,
+		corsMaxAge:               corsMaxAge,
+		rateLimitIdleTTL:         rateLimitIdleTTL,
+		rateLimitMaxKeys:         rateLimitMaxKeys,
+		trustProxyEnabled:        trustProxyEnabled,
+		debugEchoEnabled:         debugEchoEnabled,
+		debugEchoSecret:          debugEchoSecret,
+		adminAllowedIPs:          adminAllowedIPs,
+		maxInFlightPerIP:         maxInFlightPerIP,
+		logFormat:                logFormat,
+		maxResponseHeaderBytes:   maxResponseHeaderBytes,
+		disabledMiddleware:       disabledMiddleware,
+		tempDir:                  tempDir,
+		tempDirMinFreeBytes:      tempDirMinFreeBytes,
+		allowedHosts:             allowedHosts,
+		otelSampleRatio:          otelSampleRatio,
+		otelSlowRequestThreshold: otelSlowRequestThreshold,
+		captureBodyOnError:       captureBodyOnError,
+		captureBodyMaxBytes:      captureBodyMaxBytes,
+		captureBodyRedactKeys:    captureBodyRedactKeys,
+		proxyProfile:             proxyProfile,
+		proxyHeaders:             proxyHeaders,
+		requestIDMaxLength:       requestIDMaxLength,
+		recentErrorsSize:         recentErrorsSize,
+		errorCatalogFile:         errorCatalogFile,
+		errorDefaultLocale:       errorDefaultLocale,
+		concurrencyLimit:         concurrencyLimit,
+		concurrencyMaxQueue:      concurrencyMaxQueue,
+		logTTFB:                  logTTFB,
 	}, nil
 }
 
@@ -98,6 +740,17 @@ func getEnv[T any](key string, parser func(value string) (T, error), defaultValu
 	return defaultValue, nil
 }
 
+// getEnvOptional is like getEnv but treats a variable set to an empty or blank value as unset, returning
+// defaultValue. Use it for settings where an empty value has no meaning of its own, so that entries left
+// empty in env files (e.g. `OTEL_EXPORTER_OTLP_ENDPOINT=`) behave as if they were absent.
+func getEnvOptional[T any](key string, parser func(value string) (T, error), defaultValue T) (T, error) {
+	if value, ok := os.LookupEnv(key); ok && strings.TrimSpace(value) == "" {
+		return defaultValue, nil
+	}
+
+	return getEnv(key, parser, defaultValue)
+}
+
 func parseLogLevel(value string) (slog.Level, error) {
 	level := new(slog.LevelVar)
 	err := level.UnmarshalText([]byte(value))
@@ -117,6 +770,86 @@ func parseDuration(value string) (time.Duration, error) {
 	return duration, nil
 }
 
+func parsePositiveDuration(value string) (time.Duration, error) {
+	duration, err := parseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if duration <= 0 {
+		return 0, fmt.Errorf("%q must be a positive duration", value)
+	}
+
+	return duration, nil
+}
+
+func parsePositiveInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if n <= 0 {
+		return 0, fmt.Errorf("%q must be a positive integer", value)
+	}
+
+	return n, nil
+}
+
+func parseNonNegativeInt(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if n < 0 {
+		return 0, fmt.Errorf("%q must not be negative", value)
+	}
+
+	return n, nil
+}
+
+func parseAbsoluteURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%q must be an absolute URL including scheme and host (e.g. http://localhost:4318)", value)
+	}
+
+	return u, nil
+}
+
+func parseFloat(value string) (float64, error) {
+	return strconv.ParseFloat(value, 64)
+}
+
+func parseNonNegativeFloat(value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if f < 0 {
+		return 0, fmt.Errorf("%q must not be negative", value)
+	}
+
+	return f, nil
+}
+
 func parseString(value string) (string, error) {
 	return value, nil
 }
+
+func parseStringSlice(value string) ([]string, error) {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// requireContentType rejects POST, PUT, and PATCH requests carrying a body whose media type
+// is not one of contentTypes with a 415. Media type parameters such as charset are ignored.
+// Safe methods and requests without a body are passed through untouched.
+func requireContentType(contentTypes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err == nil {
+				for _, contentType := range contentTypes {
+					if strings.EqualFold(mediaType, contentType) {
+						next.ServeHTTP(w, r)
+						return
+					}
+				}
+			}
+
+			writeProblem(w, r, http.StatusUnsupportedMediaType, fmt.Sprintf("Content-Type must be one of: %s", strings.Join(contentTypes, ", ")))
+		})
+	}
+}
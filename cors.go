@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cors allows browsers on allowedOrigins to call the API from other origins. An origin of `*` allows any.
+//
+// Preflight requests, OPTIONS requests carrying an Origin and an Access-Control-Request-Method header, are
+// answered with a 204 before routing, whether or not a route exists for the path, so that browsers get a
+// clean preflight rather than a 404 or 405. Preflights from origins that aren't allowed are answered without
+// CORS headers, which browsers treat as a refusal. Other OPTIONS requests are routed normally.
+func cors(allowedOrigins, allowedMethods, allowedHeaders []string, maxAge time.Duration) func(http.Handler) http.Handler {
+	anyOrigin := slices.Contains(allowedOrigins, "*")
+	methods := strings.Join(allowedMethods, ", ")
+	headers := strings.Join(allowedHeaders, ", ")
+
+	allowed := func(origin string) bool {
+		return anyOrigin || slices.ContainsFunc(allowedOrigins, func(o string) bool {
+			return strings.EqualFold(o, origin)
+		})
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+
+			if r.Method == http.MethodOptions && origin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+				h := w.Header()
+				h.Add("Vary", "Origin")
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+
+				if allowed(origin) {
+					h.Set("Access-Control-Allow-Origin", origin)
+					h.Set("Access-Control-Allow-Methods", methods)
+					if headers != "" {
+						h.Set("Access-Control-Allow-Headers", headers)
+					}
+					if maxAge > 0 {
+						h.Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+					}
+				}
+
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			if origin != "" && allowed(origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
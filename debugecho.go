@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// debugEchoHeader carries the secret requesting a description of the request instead of its response.
+const debugEchoHeader = "X-Debug-Echo"
+
+// debugEchoMinSecretLength keeps the secret from being guessable within the rate limit.
+const debugEchoMinSecretLength = 16
+
+type debugEchoResponse struct {
+	ClientIP  string `json:"clientIp"`
+	Scheme    string `json:"scheme"`
+	Host      string `json:"host"`
+	Route     string `json:"route"`
+	RequestID string `json:"requestId"`
+	TraceID   string `json:"traceId,omitempty"`
+	BytesRead int64  `json:"bytesRead"`
+}
+
+// debugEcho answers requests whose X-Debug-Echo header matches secret with what the server resolved for them,
+// such as the client IP and scheme behind proxies, instead of calling the handler. The body is read and
+// discarded to count its bytes. Other requests are passed through, and the header is never echoed back.
+//
+// It must run after routing, as part of the api stack, for the matched route to be known.
+func debugEcho(secret string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			provided := r.Header.Get(debugEchoHeader)
+			if provided == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			handler(serveDebugEcho).ServeHTTP(w, r)
+		})
+	}
+}
+
+func serveDebugEcho(w http.ResponseWriter, r *http.Request) error {
+	n, err := io.Copy(io.Discard, r.Body)
+	if err != nil {
+		return errWrap(err, "reading request body")
+	}
+
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+
+	res := debugEchoResponse{
+		ClientIP:  clientIP(r),
+		Scheme:    scheme,
+		Host:      r.Host,
+		Route:     routePattern(r),
+		RequestID: getRequestID(r),
+		BytesRead: n,
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		res.TraceID = sc.TraceID().String()
+	}
+
+	return encode(w, r, http.StatusOK, res)
+}
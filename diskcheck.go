@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	units "github.com/docker/go-units"
+)
+
+// diskHealthCheck checks that files can be written to dir and that it has at least minFree bytes available,
+// so that a full disk shows up in readiness rather than as failing uploads or reports. The free space is
+// only checked on platforms where it can be read.
+func diskHealthCheck(dir string, minFree int64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		f, err := os.CreateTemp(dir, ".healthcheck-*")
+		if err != nil {
+			return errWrapf(err, "creating file in %s", dir)
+		}
+		defer os.Remove(f.Name())
+
+		if _, err := f.Write([]byte{0}); err != nil {
+			f.Close()
+			return errWrapf(err, "writing to %s", f.Name())
+		}
+
+		if err := f.Close(); err != nil {
+			return errWrapf(err, "closing %s", f.Name())
+		}
+
+		free, err := diskFree(dir)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return errWrapf(err, "reading free space of %s", dir)
+		}
+
+		if free < uint64(minFree) {
+			return fmt.Errorf("%s has %s available, less than the minimum of %s", dir, units.HumanSize(float64(free)), units.HumanSize(float64(minFree)))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || dragonfly || freebsd || windows)
+
+package main
+
+import "errors"
+
+// diskFree is not supported on this platform, so only writability is checked.
+func diskFree(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || dragonfly || freebsd
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// diskFree returns the number of bytes available to unprivileged users on the file system of dir.
+func diskFree(dir string) (uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import "golang.org/x/sys/windows"
+
+// diskFree returns the number of bytes available to the current user on the volume of dir.
+func diskFree(dir string) (uint64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var free uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &free, nil, nil); err != nil {
+		return 0, err
+	}
+
+	return free, nil
+}
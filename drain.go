@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// drainState tracks the progress of a graceful shutdown: when it started and how many requests are in flight.
+type drainState struct {
+	startedAt atomic.Int64
+	inFlight  atomic.Int64
+}
+
+// begin marks the start of the shutdown. Health checks fail from then on.
+func (d *drainState) begin() {
+	d.startedAt.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+func (d *drainState) shuttingDown() bool {
+	return d.startedAt.Load() != 0
+}
+
+// track counts the requests being handled by next. Hijacked connections count until their handler returns.
+func (d *drainState) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.inFlight.Add(1)
+		defer d.inFlight.Add(-1)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+type drainStatusResponse struct {
+	ShuttingDown    bool    `json:"shuttingDown"`
+	DrainingSeconds float64 `json:"drainingSeconds"`
+	InFlight        int64   `json:"inFlight"`
+}
+
+// ServeHTTP reports whether shutdown has started, for how long, and the number of requests still in flight.
+func (d *drainState) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res := drainStatusResponse{InFlight: d.inFlight.Load()}
+	if startedAt := d.startedAt.Load(); startedAt != 0 {
+		res.ShuttingDown = true
+		res.DrainingSeconds = time.Since(time.Unix(0, startedAt)).Seconds()
+	}
+
+	encode(w, r, http.StatusOK, res)
+}
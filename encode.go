@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeMsgpack = "application/msgpack"
+)
+
+func init() {
+	// json.Number values produced by decodeJSONStrict are encoded as msgpack numbers rather than strings
+	msgpack.Register(json.Number(""), func(enc *msgpack.Encoder, v reflect.Value) error {
+		n := json.Number(v.String())
+		if i, err := n.Int64(); err == nil {
+			return enc.EncodeInt(i)
+		}
+
+		f, err := n.Float64()
+		if err != nil {
+			return err
+		}
+
+		return enc.EncodeFloat64(f)
+	}, nil)
+}
+
+// responseEnvelope makes encodeData wrap payloads in an envelope. It is set from RESPONSE_ENVELOPE on startup.
+var responseEnvelope bool
+
+type envelope struct {
+	Data any          `json:"data"`
+	Meta envelopeMeta `json:"meta"`
+}
+
+type envelopeMeta struct {
+	RequestID string `json:"requestId"`
+}
+
+// encodeData is like encode but meant for successful API responses: when responseEnvelope is set, v is
+// wrapped as {"data": v, "meta": {"requestId": ...}}. Errors are written as problem+json by handler instead.
+func encodeData(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	if !responseEnvelope {
+		return encode(w, r, status, v)
+	}
+
+	return encode(w, r, status, envelope{
+		Data: v,
+		Meta: envelopeMeta{RequestID: getRequestID(r)},
+	})
+}
+
+// encode writes v as the response body with the given status in the format negotiated from the request's
+// Accept header: MessagePack when the client prefers application/msgpack, JSON otherwise.
+func encode(w http.ResponseWriter, r *http.Request, status int, v any) error {
+	w.Header().Add("Vary", "Accept")
+
+	if negotiateContentType(r.Header.Get("Accept")) == contentTypeMsgpack {
+		w.Header().Set("Content-Type", contentTypeMsgpack)
+		w.WriteHeader(status)
+
+		enc := msgpack.NewEncoder(w)
+		enc.SetCustomStructTag("json")
+
+		return errWrap(enc.Encode(v), "encoding msgpack response")
+	}
+
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(status)
+
+	return errWrap(json.NewEncoder(w).Encode(v), "encoding json response")
+}
+
+// negotiateContentType returns contentTypeMsgpack when accept weighs application/msgpack (or
+// application/x-msgpack) above JSON, and contentTypeJSON otherwise, including for unsupported
+// or malformed values. As usual, an explicit media type beats a wildcard of equal weight.
+func negotiateContentType(accept string) string {
+	var jsonQ, wildcardQ, msgpackQ float64
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case contentTypeMsgpack, "application/x-msgpack":
+			msgpackQ = max(msgpackQ, q)
+		case contentTypeJSON:
+			jsonQ = max(jsonQ, q)
+		case "application/*", "*/*":
+			wildcardQ = max(wildcardQ, q)
+		}
+	}
+
+	if msgpackQ > jsonQ && msgpackQ >= wildcardQ {
+		return contentTypeMsgpack
+	}
+
+	return contentTypeJSON
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"golang.org/x/text/language"
+)
+
+// errorCatalog localizes problem responses for errors carrying a code, see newHTTPErrorCode. Without a catalog,
+// problem responses are in English. It is a package-level var so a catalog built in code can be swapped in.
+var errorCatalog *messageCatalog
+
+// localizedMessage replaces the title and detail of a problem response. Empty fields keep the English text.
+type localizedMessage struct {
+	Title  string `json:"title"`
+	Detail string `json:"detail"`
+}
+
+// messageCatalog holds localized messages by locale and error code.
+type messageCatalog struct {
+	locales  []language.Tag
+	messages []map[string]localizedMessage
+	matcher  language.Matcher
+}
+
+// newMessageCatalog returns a catalog of messages, keyed by locale (e.g. `fr` or `pt-BR`) and then by error
+// code. Requests whose Accept-Language matches none of the locales get the messages of defaultLocale, which
+// codes missing from a locale also fall back to.
+func newMessageCatalog(defaultLocale string, messages map[string]map[string]localizedMessage) (*messageCatalog, error) {
+	def, err := language.Parse(defaultLocale)
+	if err != nil {
+		return nil, errWrapf(err, "parsing default locale %q", defaultLocale)
+	}
+
+	// the matcher falls back to the first locale
+	c := &messageCatalog{locales: []language.Tag{def}, messages: []map[string]localizedMessage{nil}}
+	for locale, msgs := range messages {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return nil, errWrapf(err, "parsing locale %q", locale)
+		}
+
+		if tag == def {
+			c.messages[0] = msgs
+			continue
+		}
+
+		c.locales = append(c.locales, tag)
+		c.messages = append(c.messages, msgs)
+	}
+	c.matcher = language.NewMatcher(c.locales)
+
+	return c, nil
+}
+
+// loadMessageCatalog reads a catalog from a JSON file shaped as
+// `{"fr": {"order_not_found": {"title": "Introuvable", "detail": "Commande introuvable"}}}`.
+func loadMessageCatalog(path, defaultLocale string) (*messageCatalog, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errWrapf(err, "reading error catalog %s", path)
+	}
+
+	var messages map[string]map[string]localizedMessage
+	if err := json.Unmarshal(b, &messages); err != nil {
+		return nil, errWrapf(err, "decoding error catalog %s", path)
+	}
+
+	return newMessageCatalog(defaultLocale, messages)
+}
+
+// lookup returns the message for code in the locale best matching acceptLanguage, along with that locale.
+func (c *messageCatalog) lookup(code, acceptLanguage string) (localizedMessage, language.Tag, bool) {
+	// a malformed header matches nothing and gets the default locale
+	prefs, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	_, i, _ := c.matcher.Match(prefs...)
+
+	if msg, ok := c.messages[i][code]; ok {
+		return msg, c.locales[i], true
+	}
+
+	if msg, ok := c.messages[0][code]; ok {
+		return msg, c.locales[0], true
+	}
+
+	return localizedMessage{}, language.Tag{}, false
+}
+
+func parseLocale(value string) (string, error) {
+	if _, err := language.Parse(value); err != nil {
+		return "", fmt.Errorf("invalid locale %q: must be a BCP 47 language tag such as en or pt-BR", value)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// maxETagBodyBytes is the largest response body cacheable will buffer to compute an ETag.
+// Larger responses are streamed through without an ETag.
+const maxETagBodyBytes = 1 << 20
+
+// cacheable sets the given Cache-Control on successful GET and HEAD responses and adds a strong ETag
+// computed from the response body, replying 304 Not Modified when it matches If-None-Match.
+// Error responses are left without it so that shared caches don't store them, and a Cache-Control
+// set by the handler is kept.
+//
+// Computing the ETag requires buffering the response in memory, up to maxETagBodyBytes per request.
+// Once a response grows beyond that it is written through as-is without an ETag, so only apply
+// this to endpoints with reasonably small bodies.
+func cacheable(cacheControl string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &etagWriter{ResponseWriter: w, limit: maxETagBodyBytes}
+			next.ServeHTTP(ew, r)
+
+			if ew.passthrough {
+				return
+			}
+
+			if ew.status != 0 && ew.status != http.StatusOK {
+				ew.flush()
+				return
+			}
+
+			// only known to be cacheable now that the status is, which also covers the 304 below
+			if w.Header().Get("Cache-Control") == "" {
+				w.Header().Set("Cache-Control", cacheControl)
+			}
+
+			sum := sha256.Sum256(ew.buf.Bytes())
+			etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+			w.Header().Set("ETag", etag)
+
+			if etagMatches(r.Header.Get("If-None-Match"), etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+
+			ew.flush()
+		})
+	}
+}
+
+// etagWriter buffers a response until it is flushed or exceeds limit, after which writes pass through.
+type etagWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	limit       int
+	passthrough bool
+}
+
+func (ew *etagWriter) WriteHeader(status int) {
+	if ew.passthrough {
+		ew.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if ew.status == 0 {
+		ew.status = status
+	}
+}
+
+func (ew *etagWriter) Write(p []byte) (int, error) {
+	if ew.passthrough {
+		return ew.ResponseWriter.Write(p)
+	}
+
+	if ew.buf.Len()+len(p) > ew.limit {
+		if err := ew.flush(); err != nil {
+			return 0, err
+		}
+
+		return ew.ResponseWriter.Write(p)
+	}
+
+	return ew.buf.Write(p)
+}
+
+// flush writes the buffered status and body and switches to passthrough mode.
+func (ew *etagWriter) flush() error {
+	ew.passthrough = true
+
+	if ew.status != 0 {
+		ew.ResponseWriter.WriteHeader(ew.status)
+	}
+
+	_, err := ew.ResponseWriter.Write(ew.buf.Bytes())
+	ew.buf.Reset()
+
+	return err
+}
+
+// etagMatches reports whether etag matches any of the entity tags in an If-None-Match header
+// using the weak comparison function.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// featureFlagHeaderPrefix prefixes the headers overriding a feature flag for a single request,
+// e.g. `X-Feature-new-checkout: true`. trustProxy strips them from requests that don't come from a trusted proxy.
+const featureFlagHeaderPrefix = "X-Feature-"
+
+// parseFeatureFlags parses FEATURE_FLAGS as comma separated `name=true|false` pairs.
+func parseFeatureFlags(value string) (map[string]bool, error) {
+	flags := map[string]bool{}
+
+	pairs, _ := parseStringSlice(value)
+	for _, pair := range pairs {
+		name, enabled, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid feature flag %q: must be formatted as name=true|false", pair)
+		}
+
+		b, err := strconv.ParseBool(strings.TrimSpace(enabled))
+		if err != nil {
+			return nil, errWrapf(err, "parsing feature flag %q", name)
+		}
+
+		flags[name] = b
+	}
+
+	return flags, nil
+}
+
+// featureFlags makes flags available to handlers through featureFlag. A configured flag can be
+// overridden for a single request with its X-Feature-<name> header, which is meant for testing.
+func featureFlags(flags map[string]bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqFlags := flags
+			overridden := false
+			for name := range flags {
+				enabled, err := strconv.ParseBool(r.Header.Get(featureFlagHeaderPrefix + name))
+				if err != nil {
+					continue
+				}
+
+				// the configured flags are shared by all requests so overrides go to a copy
+				if !overridden {
+					reqFlags = maps.Clone(flags)
+					overridden = true
+				}
+				reqFlags[name] = enabled
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyFeatureFlags, reqFlags)))
+		})
+	}
+}
+
+// featureFlag reports whether the named feature flag is enabled for the request of ctx.
+// Unknown flags are disabled.
+func featureFlag(ctx context.Context, name string) bool {
+	flags, _ := ctx.Value(ctxKeyFeatureFlags).(map[string]bool)
+	return flags[name]
+}
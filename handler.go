@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+var (
+	errNotFound     = errors.New("not found")
+	errUnauthorized = errors.New("unauthorized")
+	errForbidden    = errors.New("forbidden")
+	errConflict     = errors.New("conflict")
+)
+
+// errorStatuses maps sentinel errors, matched with errors.Is, to the status handler responds with.
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{errNotFound, http.StatusNotFound},
+	{errUnauthorized, http.StatusUnauthorized},
+	{errForbidden, http.StatusForbidden},
+	{errConflict, http.StatusConflict},
+	{context.DeadlineExceeded, http.StatusServiceUnavailable},
+	{os.ErrDeadlineExceeded, http.StatusRequestTimeout},
+}
+
+// httpError is an error carrying the status handler responds with and a message safe to show to clients.
+// The wrapped error, if any, is logged but never exposed to clients. The code, if any, identifies the error to
+// clients and selects its localized message in errorCatalog.
+type httpError struct {
+	status  int
+	code    string
+	message string
+	err     error
+}
+
+// newHTTPError returns an error answered with status and the client-safe message msg.
+func newHTTPError(status int, msg string) error {
+	return &httpError{status: status, message: msg}
+}
+
+// wrapHTTPError is like newHTTPError but wraps the internal error err, which is logged when handled.
+func wrapHTTPError(err error, status int, msg string) error {
+	return &httpError{status: status, message: msg, err: err}
+}
+
+// newHTTPErrorCode is like newHTTPError but identifies the error with code, e.g. `order_not_found`, which is
+// written to the response and used to localize msg.
+func newHTTPErrorCode(status int, code, msg string) error {
+	return &httpError{status: status, code: code, message: msg}
+}
+
+// wrapHTTPErrorCode is like wrapHTTPError but identifies the error with code, see newHTTPErrorCode.
+func wrapHTTPErrorCode(err error, status int, code, msg string) error {
+	return &httpError{status: status, code: code, message: msg, err: err}
+}
+
+func (e *httpError) Error() string {
+	if e.err == nil {
+		return e.message
+	}
+
+	return e.message + ": " + e.err.Error()
+}
+
+func (e *httpError) Unwrap() error {
+	return e.err
+}
+
+// handler adapts a handler returning an error into an http.HandlerFunc. A non-nil error is written
+// as a problem+json response, see errorResponse. fn must not have written a response when returning an error.
+//
+// Only client-safe messages are written to the response. Server errors and errors wrapped by an httpError
+// are logged, so internal details stay out of responses.
+func handler(fn func(w http.ResponseWriter, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := fn(w, r)
+		if err == nil {
+			return
+		}
+
+		status, message := errorResponse(err)
+		setResponseError(r, err.Error())
+
+		var httpErr *httpError
+		isHTTPErr := errors.As(err, &httpErr)
+		switch {
+		case status >= http.StatusInternalServerError:
+			getLogger(r).Error("Handling request", slog.Int("status", status), slog.Any("error", err))
+		case isHTTPErr && httpErr.err != nil:
+			getLogger(r).Warn("Handling request", slog.Int("status", status), slog.Any("error", err))
+		}
+
+		// a body cut off by the size limit is reported as such, whatever code the handler gave its error
+		var code string
+		if isHTTPErr && status == httpErr.status {
+			code = httpErr.code
+		}
+
+		writeProblemCode(w, r, status, code, message)
+	}
+}
+
+// errorResponse returns the status and client-safe message to respond to err with. In order of precedence:
+// 413 for a *http.MaxBytesError, the status and message of an httpError, the status mapped from a sentinel
+// error in errorStatuses along with the sentinel's message, and 500 without message otherwise.
+func errorResponse(err error) (int, string) {
+	// a body cut off by the request size limit is reported as such whatever the handler made of it
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge, maxBytesErr.Error()
+	}
+
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return httpErr.status, httpErr.message
+	}
+
+	for _, es := range errorStatuses {
+		if errors.Is(err, es.err) {
+			return es.status, es.err.Error()
+		}
+	}
+
+	return http.StatusInternalServerError, ""
+}
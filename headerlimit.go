@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// limitResponseHeaders replaces responses whose headers add up to more than maxBytes with a 500, logging a
+// warning, so that a handler emitting runaway headers, e.g. when copying them from an upstream, fails
+// visibly here rather than with an opaque error from a proxy or client. The size of a header is that of its
+// `Name: value` line. The body of a replaced response is discarded, and only the headers set before the
+// handler ran are kept.
+func limitResponseHeaders(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// headers set by outer middleware, such as CORS, are kept on a replaced response
+			next.ServeHTTP(&headerLimitWriter{ResponseWriter: w, r: r, maxBytes: maxBytes, outer: w.Header().Clone()}, r)
+		})
+	}
+}
+
+type headerLimitWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	maxBytes    int64
+	outer       http.Header
+	wroteHeader bool
+	exceeded    bool
+}
+
+func (hw *headerLimitWriter) WriteHeader(status int) {
+	// informational responses are followed by the final one, which is checked on its own
+	if hw.wroteHeader || status < http.StatusOK {
+		hw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	hw.wroteHeader = true
+
+	h := hw.Header()
+	size := headerSize(h)
+	if int64(size) <= hw.maxBytes {
+		hw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	hw.exceeded = true
+	getLogger(hw.r).Warn("Response headers too large", slog.Int("size", size), slog.Int64("limit", hw.maxBytes), slog.Int("status", status), slog.Int("headers", len(h)))
+
+	clear(h)
+	for name, values := range hw.outer {
+		h[name] = values
+	}
+	writeProblem(hw.ResponseWriter, hw.r, http.StatusInternalServerError, fmt.Sprintf("response headers exceed the maximum of %d bytes", hw.maxBytes))
+}
+
+func (hw *headerLimitWriter) Write(p []byte) (int, error) {
+	if !hw.wroteHeader {
+		hw.WriteHeader(http.StatusOK)
+	}
+
+	if hw.exceeded {
+		return len(p), nil
+	}
+
+	return hw.ResponseWriter.Write(p)
+}
+
+func (hw *headerLimitWriter) Flush() {
+	if f, ok := hw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (hw *headerLimitWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := hw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking connection: response writer does not support hijacking")
+	}
+
+	return hj.Hijack()
+}
+
+// headerSize returns the size of h written as `Name: value\r\n` lines.
+func headerSize(h http.Header) int {
+	size := 0
+	for name, values := range h {
+		for _, v := range values {
+			size += len(name) + len(v) + len(": \r\n")
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// hijackTrackingWriter records whether the connection behind a response has been hijacked,
+// after which the status and byte counts of the wrapped writer no longer mean anything.
+type hijackTrackingWriter struct {
+	middleware.WrapResponseWriter
+	hijacked bool
+}
+
+func newHijackTrackingWriter(w middleware.WrapResponseWriter) *hijackTrackingWriter {
+	return &hijackTrackingWriter{WrapResponseWriter: w}
+}
+
+func (w *hijackTrackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.WrapResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking connection: response writer does not support hijacking")
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+
+	return conn, rw, err
+}
+
+func (w *hijackTrackingWriter) Flush() {
+	if f, ok := w.WrapResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/dillonstreator/opentelemetry-go-contrib/instrumentation/net/http/otelhttp"
+)
+
+// propagateHeaders captures the named headers of incoming requests in the request context so that the client
+// returned by newHTTPClient forwards them on outbound requests made with that context.
+func propagateHeaders(names []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			headers := http.Header{}
+			for _, name := range names {
+				if values := r.Header.Values(name); len(values) > 0 {
+					headers[http.CanonicalHeaderKey(name)] = values
+				}
+			}
+
+			if len(headers) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKeyPropagatedHeaders, headers)))
+		})
+	}
+}
+
+// newHTTPClient returns a client for calling downstream services. Outbound requests are traced by otelhttp,
+// which also propagates the trace context, and carry the headers captured by propagateHeaders when they are
+// made with the incoming request's context. Headers already set on an outbound request are left untouched.
+func newHTTPClient() *http.Client {
+	return &http.Client{
+		Transport: &headerPropagatingTransport{base: otelhttp.NewTransport(http.DefaultTransport)},
+	}
+}
+
+type headerPropagatingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *headerPropagatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	headers, _ := req.Context().Value(ctxKeyPropagatedHeaders).(http.Header)
+	if len(headers) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	// a RoundTripper must not modify the request it is given
+	req = req.Clone(req.Context())
+	for name, values := range headers {
+		if _, ok := req.Header[name]; !ok {
+			req.Header[name] = values
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
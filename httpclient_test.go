@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestHTTPClientPropagation(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	// the client's transport picks up the global provider and propagator when created
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(newPropagator())
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+
+	var received http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	client := newHTTPClient()
+
+	h := propagateHeaders([]string{"X-Tenant-Id", "X-Debug"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatalf("creating request: %v", err)
+		}
+		// headers set on the outbound request win over propagated ones
+		req.Header.Set("X-Debug", "outbound")
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("calling server: %v", err)
+		}
+		res.Body.Close()
+	}))
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "incoming")
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	r.Header.Set("X-Tenant-Id", "acme")
+	r.Header.Set("X-Debug", "incoming")
+	r.Header.Set("X-Other", "ignored")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	span.End()
+
+	for name, want := range map[string]string{"X-Tenant-Id": "acme", "X-Debug": "outbound", "X-Other": ""} {
+		if got := received.Get(name); got != want {
+			t.Errorf("got %s %q, want %q", name, got, want)
+		}
+	}
+
+	// the client span is a child of the incoming span, and its context is what the server received
+	var clientSpan trace.SpanContext
+	for _, s := range exporter.GetSpans() {
+		if s.SpanKind == trace.SpanKindClient {
+			clientSpan = s.SpanContext
+			if s.Parent.SpanID() != span.SpanContext().SpanID() {
+				t.Errorf("got client span parent %s, want the incoming span %s", s.Parent.SpanID(), span.SpanContext().SpanID())
+			}
+		}
+	}
+	if !clientSpan.IsValid() {
+		t.Fatalf("got spans %v, want a client span", exporter.GetSpans())
+	}
+
+	want := "00-" + clientSpan.TraceID().String() + "-" + clientSpan.SpanID().String() + "-01"
+	if got := received.Get("Traceparent"); got != want {
+		t.Errorf("got traceparent %q, want %q", got, want)
+	}
+}
+
+func TestHTTPClientTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// outbound requests made with the request context give up once its deadline, e.g. REQUEST_TIMEOUT, passes
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("creating request: %v", err)
+	}
+
+	start := time.Now()
+	res, err := newHTTPClient().Do(req)
+	if err == nil {
+		res.Body.Close()
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("got request returning after %v, want it to give up at the deadline", elapsed)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+)
+
+// requireHTTPS enforces HTTPS on requests whose scheme is known to be plain HTTP, either by
+// 308-redirecting them to the HTTPS equivalent URL when redirect is true or by rejecting them
+// with a 403. The scheme is taken from the TLS connection or, behind a trusted proxy, from the
+// scheme resolved by trustProxy. Requests with an unknown scheme and requests for skipPaths,
+// such as health checks probed over plain HTTP, are passed through untouched.
+func requireHTTPS(redirect bool, skipPaths ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil || r.URL.Scheme != "http" || slices.Contains(skipPaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if redirect {
+				http.Redirect(w, r, absoluteURLWithScheme(r, "https", r.URL.RequestURI()), http.StatusPermanentRedirect)
+				return
+			}
+
+			writeProblem(w, r, http.StatusForbidden, "HTTPS is required")
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// inFlightLimiter caps the number of requests each client IP has in flight, bounding clients holding many
+// slow requests open, which a rate limit alone doesn't.
+type inFlightLimiter struct {
+	max      int
+	rejected metric.Int64Counter
+
+	mu sync.Mutex
+	// counts only holds clients with requests in flight, so that it doesn't grow with the number of clients seen
+	counts map[string]int
+}
+
+// newInFlightLimiter returns an inFlightLimiter allowing max requests in flight per client IP.
+// Rejections are counted by rejected.
+func newInFlightLimiter(max int, rejected metric.Int64Counter) *inFlightLimiter {
+	return &inFlightLimiter{
+		max:      max,
+		rejected: rejected,
+		counts:   map[string]int{},
+	}
+}
+
+func (l *inFlightLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.counts[ip] >= l.max {
+		return false
+	}
+
+	l.counts[ip]++
+	return true
+}
+
+func (l *inFlightLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.counts[ip] <= 1 {
+		delete(l.counts, ip)
+		return
+	}
+
+	l.counts[ip]--
+}
+
+// middleware rejects requests from client IPs already having the maximum number of requests in flight with a 429.
+func (l *inFlightLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		if !l.acquire(ip) {
+			recordRejection(r, l.rejected, "inflight_per_ip")
+			writeProblem(w, r, http.StatusTooManyRequests, fmt.Sprintf("too many requests in flight, at most %d are allowed per client", l.max))
+			return
+		}
+		defer l.release(ip)
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// decodeJSON decodes a single JSON value from the request body into v.
+// Unknown object fields and trailing data after the value are rejected. Malformed bodies are reported with
+// an httpError answered with a 400 by handler, detailing what is wrong.
+func decodeJSON(r *http.Request, v any) error {
+	return decodeJSONBody(r, v, false)
+}
+
+// decodeJSONStrict is like decodeJSON but decodes numbers into json.Number instead of float64
+// when the destination is an interface value, so large integers and decimals (e.g. ids and
+// monetary amounts) are not silently rounded.
+func decodeJSONStrict(r *http.Request, v any) error {
+	return decodeJSONBody(r, v, true)
+}
+
+func decodeJSONBody(r *http.Request, v any, useNumber bool) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if useNumber {
+		dec.UseNumber()
+	}
+
+	if err := dec.Decode(v); err != nil {
+		return jsonDecodeError(err)
+	}
+
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return newHTTPError(http.StatusBadRequest, "request body must contain a single JSON value")
+	}
+
+	return nil
+}
+
+// jsonDecodeError turns an error decoding a JSON body into a 400 httpError describing what is wrong with the
+// body. Errors reading the body, such as exceeding its size limit or read deadline, are returned wrapped so
+// that handler picks their status.
+func jsonDecodeError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return newHTTPError(http.StatusBadRequest, "request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return newHTTPError(http.StatusBadRequest, "request body contains incomplete JSON")
+	case errors.As(err, &syntaxErr):
+		return newHTTPError(http.StatusBadRequest, fmt.Sprintf("request body contains invalid JSON at offset %d", syntaxErr.Offset))
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return newHTTPError(http.StatusBadRequest, fmt.Sprintf("field %q must be %s", typeErr.Field, jsonTypeName(typeErr.Type)))
+	case errors.As(err, &typeErr):
+		return newHTTPError(http.StatusBadRequest, fmt.Sprintf("request body must be %s", jsonTypeName(typeErr.Type)))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		return newHTTPError(http.StatusBadRequest, "request body contains unknown field "+strings.TrimPrefix(err.Error(), "json: unknown field "))
+	}
+
+	return errWrap(err, "decoding json body")
+}
+
+// jsonTypeName names the JSON type Go values of type t are decoded from, with an article.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "an object"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Pointer:
+		return jsonTypeName(t.Elem())
+	}
+
+	return "a " + t.String()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// logFields collects attributes that handlers attach to the access log line of the current request.
+// Rather than introducing a context key per piece of request metadata, handlers and middleware
+// append to the logFields placed in the request context by the logging middleware, which
+// flushes them when the request has been handled.
+//
+// A logFields is only accessed from the goroutine serving the request and is not safe for
+// concurrent use. Handlers spawning goroutines must not add fields from them.
+type logFields struct {
+	attrs  []slog.Attr
+	status int
+	err    string
+}
+
+func getLogFields(r *http.Request) *logFields {
+	f, _ := r.Context().Value(ctxKeyLogFields).(*logFields)
+	return f
+}
+
+// addLogField adds attrs to the access log line of the request.
+// It is a no-op for requests not served through the logging middleware.
+func addLogField(r *http.Request, attrs ...slog.Attr) {
+	if f := getLogFields(r); f != nil {
+		f.attrs = append(f.attrs, attrs...)
+	}
+}
+
+// setLogStatus makes the access log line of the request report status instead of the status written
+// to the response, e.g. for a stream that has already responded 200 but ends in failure.
+// It is a no-op for requests not served through the logging middleware.
+func setLogStatus(r *http.Request, status int) {
+	if f := getLogFields(r); f != nil {
+		f.status = status
+	}
+}
+
+// statusOr returns the status set with setLogStatus, or written when none was set.
+func (f *logFields) statusOr(written int) int {
+	if f.status != 0 {
+		return f.status
+	}
+
+	return written
+}
+
+// setResponseError records err as what the request failed with, as reported by GET /admin/errors.
+// The first error set is kept, so that the error a handler returned takes precedence over the detail of
+// the problem response written for it. It is a no-op for requests not served through the logging middleware.
+func setResponseError(r *http.Request, err string) {
+	if f := getLogFields(r); f != nil && f.err == "" {
+		f.err = err
+	}
+}
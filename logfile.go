@@ -0,0 +1,78 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// logFile is a log file which can be reopened at the same path, so that a file moved or
+// truncated by external log rotation is recreated.
+type logFile struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func openLogFile(path string) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logFile{path: path, f: f}, nil
+}
+
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	return lf.f.Write(p)
+}
+
+// reopen swaps the file for a newly opened one at the same path. The current file is kept
+// when the path can't be opened.
+func (lf *logFile) reopen() error {
+	f, err := os.OpenFile(lf.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	lf.mu.Lock()
+	old := lf.f
+	lf.f = f
+	lf.mu.Unlock()
+
+	return old.Close()
+}
+
+func (lf *logFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	return lf.f.Close()
+}
+
+// reopenOnSignal reopens lf whenever one of logReopenSignals is received.
+// It is a no-op on platforms without reopen signals.
+func reopenOnSignal(lf *logFile, logger *slog.Logger) {
+	if len(logReopenSignals) == 0 {
+		return
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, logReopenSignals...)
+
+	go func() {
+		for sig := range sigs {
+			if err := lf.reopen(); err != nil {
+				logger.Error("Reopening log file", slog.String("path", lf.path), slog.String("signal", sig.String()), slog.Any("error", err))
+				continue
+			}
+
+			logger.Info("Reopened log file", slog.String("path", lf.path), slog.String("signal", sig.String()))
+		}
+	}()
+}
@@ -1,14 +1,40 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"log/slog"
+	"slices"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/baggage"
+)
+
+const (
+	logFormatJSON   = "json"
+	logFormatText   = "text"
+	logFormatLogfmt = "logfmt"
 )
 
-func newLogger(w io.Writer, lvl slog.Level) *slog.Logger {
-	logger := slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
-		Level: lvl,
-		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+// parseLogFormat validates a LOG_FORMAT: `json`, `text`, or `logfmt`.
+func parseLogFormat(value string) (string, error) {
+	switch value {
+	case logFormatJSON, logFormatText, logFormatLogfmt:
+		return value, nil
+	}
+
+	return "", fmt.Errorf("invalid log format %q: must be one of %s, %s, or %s", value, logFormatJSON, logFormatText, logFormatLogfmt)
+}
+
+// newLogger returns a logger writing records at or above lvl to w in format. `json` and `logfmt` write the time
+// as `ts` in Unix nanoseconds and the level as `lvl`, `text` keeps slog's human readable defaults. logfmt is
+// what slog's text handler writes: space separated `key=value` pairs, quoting values where needed, e.g. with
+// spaces, and joining group names to keys with dots.
+func newLogger(w io.Writer, lvl slog.Level, format string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: lvl}
+	if format != logFormatText {
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
 			if a.Key == slog.TimeKey {
 				a.Key = "ts"
 				a.Value = slog.Int64Value(a.Value.Time().UnixNano())
@@ -18,8 +44,174 @@ func newLogger(w io.Writer, lvl slog.Level) *slog.Logger {
 			}
 
 			return a
-		},
-	}))
+		}
+	}
+
+	var h slog.Handler
+	if format == logFormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+
+	return slog.New(newDedupHandler(h))
+}
+
+// dedupHandler keeps only the last value of attributes sharing a key within a record, including those
+// added with Logger.With, since slog's JSON handler writes every one of them and some parsers reject
+// objects with duplicate keys. Keys are compared within their group. The first time a duplicate is dropped,
+// a warning naming its key is logged so that the offending code can be fixed.
+//
+// Attributes are handed to the wrapped handler when a record is handled rather than when added, so a
+// logger derived with With formats them for every record instead of once.
+type dedupHandler struct {
+	next   slog.Handler
+	goas   []groupOrAttrs
+	warned *atomic.Bool
+}
+
+// groupOrAttrs is either a group opened with WithGroup or attributes added with WithAttrs.
+type groupOrAttrs struct {
+	group string
+	attrs []slog.Attr
+}
+
+func newDedupHandler(next slog.Handler) *dedupHandler {
+	return &dedupHandler{next: next, warned: &atomic.Bool{}}
+}
+
+func (h *dedupHandler) Enabled(ctx context.Context, lvl slog.Level) bool {
+	return h.next.Enabled(ctx, lvl)
+}
+
+func (h *dedupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	return h.with(groupOrAttrs{attrs: attrs})
+}
+
+func (h *dedupHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return h.with(groupOrAttrs{group: name})
+}
+
+func (h *dedupHandler) with(goa groupOrAttrs) *dedupHandler {
+	return &dedupHandler{
+		next:   h.next,
+		goas:   append(slices.Clip(h.goas), goa),
+		warned: h.warned,
+	}
+}
+
+func (h *dedupHandler) Handle(ctx context.Context, r slog.Record) error {
+	// the record's attributes belong to the innermost group, so the groups are nested from the inside out
+	var attrs []slog.Attr
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	var duplicate string
+	for i := len(h.goas) - 1; i >= -1; i-- {
+		if i >= 0 && h.goas[i].group == "" {
+			attrs = append(slices.Clip(h.goas[i].attrs), attrs...)
+			continue
+		}
+
+		var dup string
+		attrs, dup = dedupAttrs(attrs)
+		if duplicate == "" {
+			duplicate = dup
+		}
+
+		if i >= 0 {
+			attrs = []slog.Attr{{Key: h.goas[i].group, Value: slog.GroupValue(attrs...)}}
+		}
+	}
+
+	deduped := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	deduped.AddAttrs(attrs...)
+
+	if err := h.next.Handle(ctx, deduped); err != nil {
+		return err
+	}
+
+	if duplicate != "" && h.next.Enabled(ctx, slog.LevelWarn) && h.warned.CompareAndSwap(false, true) {
+		warning := slog.NewRecord(r.Time, slog.LevelWarn, "Dropped duplicate log attribute", 0)
+		warning.AddAttrs(slog.String("key", duplicate))
+		return h.next.Handle(ctx, warning)
+	}
+
+	return nil
+}
+
+// dedupAttrs returns attrs keeping only the last of those sharing a key, at its position, along with one of the
+// dropped keys, if any. Groups without a key are inlined, as slog does, and groups are deduplicated recursively.
+func dedupAttrs(attrs []slog.Attr) ([]slog.Attr, string) {
+	var duplicate string
+
+	flat := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Value.Kind() != slog.KindGroup {
+			flat = append(flat, a)
+			continue
+		}
+
+		group, dup := dedupAttrs(a.Value.Group())
+		if duplicate == "" {
+			duplicate = dup
+		}
+
+		if a.Key == "" {
+			flat = append(flat, group...)
+		} else {
+			flat = append(flat, slog.Attr{Key: a.Key, Value: slog.GroupValue(group...)})
+		}
+	}
+
+	last := make(map[string]int, len(flat))
+	for i, a := range flat {
+		if _, ok := last[a.Key]; ok && duplicate == "" {
+			duplicate = a.Key
+		}
+		last[a.Key] = i
+	}
+
+	if len(last) == len(flat) {
+		return flat, duplicate
+	}
+
+	deduped := make([]slog.Attr, 0, len(last))
+	for i, a := range flat {
+		if last[a.Key] == i {
+			deduped = append(deduped, a)
+		}
+	}
+
+	return deduped, duplicate
+}
+
+// baggageAttrs returns the values of the given baggage keys present in ctx as log attributes.
+// Keys missing from the baggage are skipped.
+func baggageAttrs(ctx context.Context, keys []string) []any {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	bag := baggage.FromContext(ctx)
+
+	var attrs []any
+	for _, key := range keys {
+		if member := bag.Member(key); member.Key() != "" {
+			attrs = append(attrs, slog.String(key, member.Value()))
+		}
+	}
 
-	return logger
+	return attrs
 }
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// decodeLogLines decodes every JSON log line written to buf.
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("decoding log line %q: %v", line, err)
+		}
+		lines = append(lines, m)
+	}
+
+	return lines
+}
+
+func TestDedupHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(l *slog.Logger)
+		// want are the attributes of the logged record, without time, level, and message
+		want map[string]any
+		// line is a substring of the raw record, asserting that no duplicate key was written
+		line    string
+		dropped string
+	}{
+		{
+			name:    "record overrides With",
+			log:     func(l *slog.Logger) { l.With("a", 1).Info("m", "a", 2) },
+			want:    map[string]any{"a": 2.0},
+			line:    `"msg":"m","a":2}`,
+			dropped: "a",
+		},
+		{
+			name:    "later With overrides earlier With",
+			log:     func(l *slog.Logger) { l.With("a", 1, "b", 1).With("a", 2).Info("m") },
+			want:    map[string]any{"a": 2.0, "b": 1.0},
+			line:    `"msg":"m","b":1,"a":2}`,
+			dropped: "a",
+		},
+		{
+			name:    "duplicates within a record",
+			log:     func(l *slog.Logger) { l.Info("m", "a", 1, "b", 1, "a", 2) },
+			want:    map[string]any{"a": 2.0, "b": 1.0},
+			line:    `"msg":"m","b":1,"a":2}`,
+			dropped: "a",
+		},
+		{
+			name: "same key in different groups",
+			log:  func(l *slog.Logger) { l.With("a", 1).WithGroup("g").Info("m", "a", 2) },
+			want: map[string]any{"a": 1.0, "g": map[string]any{"a": 2.0}},
+			line: `"msg":"m","a":1,"g":{"a":2}}`,
+		},
+		{
+			name: "nested groups",
+			log: func(l *slog.Logger) {
+				l.WithGroup("g").With("a", 1).WithGroup("h").With("b", 1).Info("m", "b", 2, slog.Group("i", "c", 1, "c", 2))
+			},
+			want: map[string]any{"g": map[string]any{"a": 1.0, "h": map[string]any{"b": 2.0, "i": map[string]any{"c": 2.0}}}},
+			line: `"msg":"m","g":{"a":1,"h":{"b":2,"i":{"c":2}}}}`,
+			// the innermost duplicate is reported
+			dropped: "c",
+		},
+		{
+			name: "group attributes merge with the group opened by WithGroup",
+			log: func(l *slog.Logger) {
+				l.WithGroup("g").With("a", 1).Info("m", "a", 2)
+			},
+			want:    map[string]any{"g": map[string]any{"a": 2.0}},
+			line:    `"msg":"m","g":{"a":2}}`,
+			dropped: "a",
+		},
+		{
+			name:    "inlined empty group",
+			log:     func(l *slog.Logger) { l.With("a", 1).Info("m", slog.Group("", "a", 2, "b", 1)) },
+			want:    map[string]any{"a": 2.0, "b": 1.0},
+			line:    `"msg":"m","a":2,"b":1}`,
+			dropped: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.log(newLogger(&buf, slog.LevelInfo, logFormatJSON))
+
+			if !strings.Contains(buf.String(), tt.line) {
+				t.Errorf("got log %q, want it to contain %q", buf.String(), tt.line)
+			}
+
+			lines := decodeLogLines(t, &buf)
+
+			got := lines[0]
+			for _, key := range []string{"ts", "lvl", "msg"} {
+				delete(got, key)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got attributes %v, want %v", got, tt.want)
+			}
+
+			if tt.dropped == "" {
+				if len(lines) != 1 {
+					t.Errorf("got %d log lines, want no warning", len(lines))
+				}
+				return
+			}
+
+			if len(lines) != 2 {
+				t.Fatalf("got %d log lines, want a warning", len(lines))
+			}
+			if warning := lines[1]; warning["msg"] != "Dropped duplicate log attribute" || warning["lvl"] != "WARN" || warning["key"] != tt.dropped {
+				t.Errorf("got warning %v, want one naming key %q", warning, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestDedupHandlerWarnsOnce(t *testing.T) {
+	var buf bytes.Buffer
+	l := newLogger(&buf, slog.LevelInfo, logFormatJSON)
+
+	// loggers derived from the same logger share whether the warning was logged
+	l.Info("m", "a", 1, "a", 2)
+	l.With("b", 1).Info("m", "b", 2)
+	l.WithGroup("g").Info("m", "c", 1, "c", 2)
+
+	var warnings int
+	for _, line := range decodeLogLines(t, &buf) {
+		if line["msg"] == "Dropped duplicate log attribute" {
+			warnings++
+		}
+	}
+
+	if warnings != 1 {
+		t.Errorf("got %d warnings, want 1", warnings)
+	}
+}
+
+func TestNewLoggerLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	newLogger(&buf, slog.LevelInfo, logFormatLogfmt).Info("Request handled", "ua", `my agent "x"`, slog.Group("tls", "version", "TLS 1.3"))
+
+	line := strings.TrimSuffix(buf.String(), "\n")
+
+	ts, rest, ok := strings.Cut(line, " ")
+	if !ok || !strings.HasPrefix(ts, "ts=") {
+		t.Fatalf("got log %q, want it to start with ts", line)
+	}
+	if _, err := strconv.ParseInt(strings.TrimPrefix(ts, "ts="), 10, 64); err != nil {
+		t.Errorf("got %s, want the time in Unix nanoseconds", ts)
+	}
+
+	want := `lvl=INFO msg="Request handled" ua="my agent \"x\"" tls.version="TLS 1.3"`
+	if rest != want {
+		t.Errorf("got log %q, want %q after ts", rest, want)
+	}
+}
@@ -2,25 +2,33 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"log/slog"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	// NOTE: github.com/dillonstreator/opentelemetry-go-contrib/instrumentation/net/http/otelhttp is required
-	// until https://github.com/open-telemetry/opentelemetry-go-contrib/pull/4591 is reviewed/merged
-	// to ensure panic recovery logging includes request id and trace id
+	// NOTE: github.com/dillonstreator/opentelemetry-go-contrib/instrumentation/net/http/otelhttp overwrites the
+	// request so that middleware running before it sees the trace context, see
+	// https://github.com/open-telemetry/opentelemetry-go-contrib/pull/4591. Panic recovery no longer depends on
+	// it since it runs after the logging middleware, so upstream otelhttp can replace it
 	"github.com/dillonstreator/opentelemetry-go-contrib/instrumentation/net/http/otelhttp"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
-	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/netutil"
 )
 
 func main() {
@@ -29,91 +37,363 @@ func main() {
 		log.Fatal(err)
 	}
 
-	logger := newLogger(os.Stdout, cfg.logLevel)
+	logger := newLogger(os.Stdout, cfg.logLevel, cfg.logFormat)
 
-	otelShutdown, err := setupOTelSDK(context.Background(), cfg)
+	// bind before setting anything else up so that a taken port fails startup right away and clearly
+	ln, err := listen(cfg.port, cfg.reusePort, cfg.maxConnections, cfg.maxAcceptsPerSecond, cfg.maxAcceptsBurst)
 	if err != nil {
-		logger.Error("Setting up open telemetry", slog.Any("error", err))
+		logListenError(logger, cfg.port, err)
 		os.Exit(1)
 	}
 
+	var adminLn net.Listener
+	if cfg.adminPort != 0 {
+		adminLn, err = listen(cfg.adminPort, cfg.reusePort, 0, 0, 0)
+		if err != nil {
+			logListenError(logger, cfg.adminPort, err)
+			os.Exit(1)
+		}
+	}
+
+	useRequestIDGenerator(cfg.requestIDGenerator)
+	responseEnvelope = cfg.responseEnvelope
+	maxMultipart = multipartLimits{
+		maxFields:     cfg.multipartMaxFields,
+		maxFiles:      cfg.multipartMaxFiles,
+		maxFieldBytes: cfg.multipartMaxFieldBytes,
+	}
+
+	// access logs go to the application logger unless a dedicated file is configured
+	accessLogger := logger
+	var accessLogFile *logFile
+	if cfg.accessLogFile != "" {
+		accessLogFile, err = openLogFile(cfg.accessLogFile)
+		if err != nil {
+			logger.Error("Opening access log file", slog.String("path", cfg.accessLogFile), slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		accessLogger = newLogger(accessLogFile, cfg.logLevel, cfg.logFormat)
+		reopenOnSignal(accessLogFile, logger)
+	}
+
+	if cfg.errorCatalogFile != "" {
+		errorCatalog, err = loadMessageCatalog(cfg.errorCatalogFile, cfg.errorDefaultLocale)
+		if err != nil {
+			logger.Error("Loading error catalog", slog.String("path", cfg.errorCatalogFile), slog.Any("error", err))
+			os.Exit(1)
+		}
+	}
+
+	otelSetupCtx, otelSetupCancel := context.WithTimeout(context.Background(), cfg.otelSetupTimeout)
+	otelShutdown, err := setupOTelSDK(otelSetupCtx, cfg)
+	otelSetupCancel()
+	tracing := cfg.otelEnabled && err == nil
+	if err != nil {
+		if !cfg.otelFailOpen {
+			logger.Error("Setting up open telemetry", slog.Any("error", err))
+			os.Exit(1)
+		}
+
+		// the global providers are left as no-ops so the service runs without tracing
+		logger.Warn("Setting up open telemetry, continuing without tracing", slog.Any("error", err))
+	}
+
+	metricsHandler, metricsShutdown, err := setupMetrics(cfg)
+	if err != nil {
+		logger.Error("Setting up metrics", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	inst, err := newInstruments()
+	if err != nil {
+		logger.Error("Creating metric instruments", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// background jobs are handed off to the pool, which is drained on shutdown
+	jobs, err := newWorkerPool(cfg.workerPoolSize, cfg.workerPoolQueueSize, logger.With("log", "jobs"))
+	if err != nil {
+		logger.Error("Creating worker pool", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	tmpl, err := loadTemplates(cfg.templatesDir)
+	if err != nil {
+		logger.Error("Loading templates", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	openAPISpec, err := loadOpenAPISpec(cfg.openAPISpecPath)
+	if err != nil {
+		logger.Error("Loading openapi spec", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	shutdown := make(chan os.Signal, 1)
+	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+
+	// handled counts requests to restart the process after cfg.maxRequestsBeforeRestart of them
+	var handled atomic.Int64
+
+	// durations and rate limits are measured with clk rather than with time directly
+	var clk clock = systemClock{}
+
+	// health checks fail once a shutdown signal is received so load balancers
+	// stop routing new requests while in-flight ones drain
+	drain := &drainState{}
+
+	// failed requests are kept for GET /admin/errors
+	var recent *recentErrors
+	if cfg.recentErrorsSize > 0 {
+		recent = newRecentErrors(cfg.recentErrorsSize)
+	}
+
 	mux := chi.NewMux()
-	mux.Use(middleware.Recoverer)
-	mux.Use(trustProxy(logger))
-	mux.Use(otelhttp.NewMiddleware("chi"))
-	mux.Use(func(h http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			start := time.Now()
+	// use adds middleware of the base stack unless DISABLE_MIDDLEWARE names it
+	use := func(name string, mw func(http.Handler) http.Handler) {
+		if cfg.disabledMiddleware[name] {
+			logger.Info("Middleware disabled", slog.String("middleware", name))
+			return
+		}
 
-			traceID := trace.SpanFromContext(r.Context()).SpanContext().TraceID()
-			var reqID string
+		mux.Use(mw)
+	}
 
-			if id, err := uuid.Parse(r.Header.Get("x-request-id")); err == nil {
-				reqID = id.String()
-			} else {
-				reqID = uuid.NewString()
+	if cfg.servedByEnabled {
+		// set before anything else so that every response carries it, including recovered panics
+		mux.Use(middleware.SetHeader(servedByHeader, servedBy(cfg.serviceName, cfg.serviceVersion, cfg.serviceInstanceID)))
+	}
+	use(middlewareDrain, drain.track)
+	// without a proxy in front no request is trusted, which still strips the headers reserved to proxies.
+	// Disabling trustproxy does the same rather than removing it, so that clients can't set those headers
+	trustedProxies := cfg.trustedProxies
+	if cfg.trustProxyEnabled && !cfg.disabledMiddleware[middlewareTrustProxy] {
+		logger.Info("Trusting proxy headers", slog.String("profile", cfg.proxyProfile), slog.Int("trustedProxies", len(trustedProxies)), slog.Int("hopCount", cfg.trustedProxyHopCount))
+	} else {
+		trustedProxies = nil
+		logger.Info("Ignoring proxy headers, client details are taken from the connection")
+	}
+	mux.Use(trustProxy(logger, trustedProxies, cfg.trustedProxyHopCount, cfg.proxyHeaders))
+	use(middlewareOtel, otelhttp.NewMiddleware("chi"))
+	if cfg.disabledMiddleware[middlewareLogging] {
+		logger.Warn("Logging middleware can't be disabled, the logger, request id, and log fields of requests depend on it")
+	}
+	mux.Use(requestLogging(cfg, logger, accessLogger, clk, inst, recent, func() {
+		if n := handled.Add(1); cfg.maxRequestsBeforeRestart > 0 && n == int64(cfg.maxRequestsBeforeRestart) {
+			// a shutdown may already be pending, in which case there is nothing left to trigger
+			select {
+			case shutdown <- maxRequestsSignal{}:
+			default:
 			}
+		}
+	}))
 
-			l := logger.With("reqId", reqID, "traceId", traceID)
+	// panics are recovered within the logging middleware so that the recoverer finds the request's log entry
+	// and the access log reports the 500
+	use(middlewareRecoverer, recoverer)
+	use(middlewareBodyReadTimeout, bodyReadTimeout(cfg.bodyReadTimeout))
+	use(middlewareFeatureFlags, featureFlags(cfg.featureFlags))
 
-			ww := middleware.NewWrapResponseWriter(w, 0)
-			rc := newByteReadCloser(r.Body)
-			r.Body = http.MaxBytesReader(w, rc, cfg.maxAllowedRequestBytes)
+	if len(cfg.propagateHeaders) > 0 {
+		mux.Use(propagateHeaders(cfg.propagateHeaders))
+	}
 
-			// overwrite `r`'s memory so that recoverer can access the log entry
-			*r = *setLogger(r, l)
-			*r = *middleware.WithLogEntry(r, newLogEntry(l))
+	if cfg.gzipEnabled {
+		mux.Use(compress(cfg.compressionEncodings, cfg.gzipSkipContentTypes))
+	}
 
-			h.ServeHTTP(ww, r)
+	// the host is checked once trustProxy has resolved it and before anything, including preflights, answers
+	if len(cfg.allowedHosts) > 0 {
+		mux.Use(allowHosts(cfg.allowedHosts, cfg.healthEndpoint, "/readyz", "/metrics"))
+	}
 
-			l.Info(
-				"Request handled",
-				slog.String("method", r.Method),
-				slog.String("method", r.Method),
-				slog.String("path", r.URL.Path),
-				slog.String("ua", r.UserAgent()),
-				slog.String("ip", r.RemoteAddr),
-				slog.Int("bw", ww.BytesWritten()),
-				slog.Int64("br", rc.BytesRead()),
-				slog.Int("status", ww.Status()),
-				slog.Duration("duration", time.Since(start)),
-			)
-		})
-	})
+	// preflights are answered here, before routing, so that they succeed for any path
+	if len(cfg.corsAllowedOrigins) > 0 {
+		mux.Use(cors(cfg.corsAllowedOrigins, cfg.corsAllowedMethods, cfg.corsAllowedHeaders, cfg.corsMaxAge))
+	}
+
+	// checks that can reject a request from its headers alone run before anything reads the body
+	if cfg.httpsRedirect || cfg.httpsRequire {
+		mux.Use(requireHTTPS(cfg.httpsRedirect, cfg.healthEndpoint, "/readyz", "/metrics"))
+	}
+
+	use(middlewareTrailingSlash, trailingSlash(cfg.trailingSlash))
+	use(middlewareBodyLimit, rejectOversizedBody(cfg.maxAllowedRequestBytes))
+	use(middlewareTimeout, requestTimeout(cfg.requestTimeout, clk))
+
+	if cfg.maxResponseHeaderBytes > 0 {
+		mux.Use(limitResponseHeaders(cfg.maxResponseHeaderBytes))
+	}
+
+	// the middleware above is the base stack every route goes through, application routes are added to
+	// api to go through the api stack as well while probes stay on mux
+	apiCtx, stopAPI := context.WithCancel(context.Background())
+	defer stopAPI()
+	apiMws, err := apiMiddleware(apiCtx, cfg, clk, inst)
+	if err != nil {
+		logger.Error("Creating api middleware", slog.Any("error", err))
+		os.Exit(1)
+	}
+	api := mux.With(apiMws...)
 
 	mux.Get(cfg.healthEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		if drain.shuttingDown() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
 		w.WriteHeader(http.StatusOK)
 	})
 
-	mux.Get("/hi", func(w http.ResponseWriter, r *http.Request) {
+	if cfg.otelEnabled && cfg.otelExporterOTLPEndpoint != nil {
+		// without a reachable collector the service still works, but traces are silently dropped
+		if cfg.otelHealthCheckRequired {
+			registerHealthCheck("otlp", otlpHealthCheck(cfg.otelExporterOTLPEndpoint))
+		} else {
+			registerOptionalHealthCheck("otlp", otlpHealthCheck(cfg.otelExporterOTLPEndpoint))
+		}
+	}
+
+	if cfg.tempDir != "" {
+		registerHealthCheck("disk", diskHealthCheck(cfg.tempDir, cfg.tempDirMinFreeBytes))
+	}
+
+	// dependency checks are refreshed in the background so that frequent readiness probes stay cheap
+	ready := newReadiness(healthChecks)
+	readyCtx, stopReadiness := context.WithCancel(context.Background())
+	defer stopReadiness()
+	go ready.refresh(readyCtx, cfg.readinessCacheInterval)
+
+	mux.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if drain.shuttingDown() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		ready.ServeHTTP(w, r)
+	})
+
+	api.With(cacheable("public, max-age=60")).Get("/hi", func(w http.ResponseWriter, r *http.Request) {
 		l := getLogger(r)
 		l.Info("hi")
+		addLogField(r, slog.String("greeting", "hi"))
+		if remaining(r.Context()) < 10*time.Millisecond {
+			l.Warn("Little time left to respond")
+		}
 		w.Write([]byte("hi"))
 	})
 
-	mux.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+	// the page is the same for every client, so a burst of requests renders it once
+	api.With(coalesce()).Get("/hello", func(w http.ResponseWriter, r *http.Request) {
+		renderTemplate(w, r, tmpl, "hello.html", map[string]string{
+			"ServiceName":    cfg.serviceName,
+			"ServiceVersion": cfg.serviceVersion,
+		})
+	})
+
+	api.Post("/echo", handler(func(w http.ResponseWriter, r *http.Request) error {
+		var body any
+		if err := decodeJSONStrict(r, &body); err != nil {
+			return err
+		}
+
+		return encodeData(w, r, http.StatusOK, body)
+	}))
+
+	if openAPISpec != nil {
+		mountOpenAPI(api, openAPISpec, cfg.swaggerUIEnabled)
+	}
+
+	sockets := newWebSockets(cfg.maxAllowedRequestBytes)
+	api.Get("/ws", sockets.echo)
+
+	api.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
 		panic("testing panic recovery and logging")
 	})
 
+	for _, register := range routeRegistrars {
+		api.Group(register)
+	}
+
+	if cfg.adminEnabled {
+		logGoroutinesOnSignal(logger)
+	}
+
+	root := chi.NewMux()
+	root.Use(limitURLLength(cfg.maxURLLength, cfg.maxQueryLength))
+
+	// errors net/http logs on its own, such as TLS handshake failures, go through the structured logger
+	serverErrorLog := slog.NewLogLogger(logger.With("source", "http.Server").Handler(), slog.LevelWarn)
+
+	// operational routes are served on their own listener when ADMIN_PORT is set
+	// so they are never exposed on the public traffic port
+	var adminSrv *http.Server
+	if cfg.adminPort != 0 {
+		adminMux := chi.NewMux()
+		mountOpsRoutes(adminMux, cfg, metricsHandler, drain, ready, recent)
+
+		adminSrv = &http.Server{
+			Addr:     fmt.Sprintf(":%d", cfg.adminPort),
+			Handler:  adminMux,
+			ErrorLog: serverErrorLog,
+		}
+	} else {
+		mountOpsRoutes(root, cfg, metricsHandler, drain, ready, recent)
+	}
+
+	root.Mount("/", mux)
+
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.port),
-		Handler: mux,
+		Handler: root,
+		// requests exceeding this are answered by net/http with a plain text 431 before
+		// reaching any handler, so they never pass through the middleware or access log
+		MaxHeaderBytes: int(cfg.maxHeaderBytes),
+		ErrorLog:       serverErrorLog,
 	}
 
-	go func() {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Error("Server error", slog.Any("error", err))
+	// websocket connections are hijacked, so shutting down the server doesn't close them
+	srv.RegisterOnShutdown(sockets.close)
+
+	proto := "HTTP"
+	if cfg.tlsCertFile != "" {
+		certs, err := newCertReloader(cfg.tlsCertFile, cfg.tlsKeyFile)
+		if err != nil {
+			logger.Error("Loading TLS certificate", slog.Any("error", err))
 			os.Exit(1)
 		}
-	}()
+		certs.reloadOnSignal(logger)
 
-	logger.Info(fmt.Sprintf("Listening for HTTP on port %d", cfg.port))
+		srv.TLSConfig = &tls.Config{GetCertificate: certs.getCertificate}
+		proto = "HTTPS"
+	}
 
-	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, syscall.SIGINT, syscall.SIGTERM)
+	serve(srv, ln, logger)
+	var listenAttrs []any
+	if cfg.maxConnections > 0 {
+		listenAttrs = append(listenAttrs, slog.Int("maxConnections", cfg.maxConnections))
+	}
+	logger.Info(fmt.Sprintf("Listening for %s on port %d", proto, cfg.port), listenAttrs...)
+
+	if adminSrv != nil {
+		serve(adminSrv, adminLn, logger)
+		logger.Info(fmt.Sprintf("Listening for admin HTTP on port %d", cfg.adminPort))
+	}
+
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "Startup summary", startupSummary(cfg, tracing)...)
 
 	sig := <-shutdown
 	logger.Info("Shutdown signal received", "signal", sig.String())
+	drain.begin()
+	stopReadiness()
+
+	if delay := drainDelay(cfg.shutdownDrainDelay, cfg.shutdownDrainJitter); delay > 0 {
+		logger.Info("Waiting before shutdown", slog.Duration("delay", delay))
+		time.Sleep(delay)
+	}
+
+	exitCode := 0
 
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
 	defer cancel()
@@ -121,16 +401,256 @@ func main() {
 	err = srv.Shutdown(ctx)
 	if err != nil {
 		logger.Error("Server shutdown", slog.Any("error", err))
-		os.Exit(1)
+		exitCode = 1
 	}
 
-	err = otelShutdown(ctx)
+	err = sockets.wait(ctx)
+	if err != nil {
+		logger.Error("WebSocket shutdown", slog.Any("error", err))
+		exitCode = 1
+	}
+
+	// handlers may have submitted jobs until the server was drained
+	err = jobs.shutdown(ctx)
+	if err != nil {
+		logger.Error("Worker pool shutdown", slog.Any("error", err))
+		exitCode = 1
+	}
+
+	// the admin server is shut down after the main server has drained
+	// so operational endpoints remain reachable while requests complete
+	if adminSrv != nil {
+		err = adminSrv.Shutdown(ctx)
+		if err != nil {
+			logger.Error("Admin server shutdown", slog.Any("error", err))
+			exitCode = 1
+		}
+	}
+
+	// telemetry is flushed with its own budget, even when the HTTP drain failed or ran out of time,
+	// so a slow drain can't prevent spans from being exported and vice versa
+	otelCtx, otelCancel := context.WithTimeout(context.Background(), cfg.otelShutdownTimeout)
+	defer otelCancel()
+
+	err = errors.Join(otelShutdown(otelCtx), metricsShutdown(otelCtx))
 	if err != nil {
 		logger.Error("Open telemetry shutdown", slog.Any("error", err))
-		os.Exit(1)
+		exitCode = 1
+	}
+
+	if accessLogFile != nil {
+		err = accessLogFile.Close()
+		if err != nil {
+			logger.Error("Closing access log file", slog.Any("error", err))
+			exitCode = 1
+		}
+	}
+
+	if exitCode != 0 {
+		cancel()
+		otelCancel()
+		os.Exit(exitCode)
+	}
+}
+
+// requestLogging resolves the request id and sets up the logger and log fields of requests, and logs a
+// `Request handled` line to accessLogger for each of them once handled, after which onHandled is called.
+// Failed requests are added to recent when it isn't nil.
+func requestLogging(cfg *config, logger, accessLogger *slog.Logger, clk clock, inst *instruments, recent *recentErrors, onHandled func()) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := clk.Now()
+
+			span := trace.SpanFromContext(r.Context())
+			reqID := resolveRequestID(r.Header.Get("x-request-id"), cfg.requestIDAcceptAny, cfg.requestIDMaxLength)
+
+			// correlate spans with the same fields found in the logs
+			if span.IsRecording() {
+				span.SetAttributes(
+					attribute.String("request.id", reqID),
+					semconv.ClientAddress(clientIP(r)),
+					semconv.UserAgentOriginal(r.UserAgent()),
+				)
+			}
+
+			reqAttrs := []any{"reqId", reqID, "version", cfg.serviceVersion}
+			// without tracing the span context is invalid and its trace id all zeros
+			if sc := span.SpanContext(); sc.IsValid() {
+				reqAttrs = append(reqAttrs, "traceId", sc.TraceID())
+			}
+			if attrs := baggageAttrs(r.Context(), cfg.logBaggageKeys); len(attrs) > 0 {
+				reqAttrs = append(reqAttrs, slog.Group("baggage", attrs...))
+			}
+
+			l := logger.With(reqAttrs...)
+
+			fbw := newFirstByteWriter(middleware.NewWrapResponseWriter(w, 0), clk)
+			ww := newHijackTrackingWriter(fbw)
+			rc := newByteReadCloser(r.Body)
+			body := newLimitedBody(w, rc, cfg.maxAllowedRequestBytes)
+			// net/http sets http.NoBody when there is no body, and chunked bodies of unknown length don't get it,
+			// so only bodiless requests skip the wrapping and keep http.NoBody for middleware checking for it
+			var capture *bodyCapture
+			if r.Body != http.NoBody {
+				r.Body = body
+				// only what is within the body limit is captured, and only when the handler reads it
+				if cfg.captureBodyOnError {
+					if capture = newBodyCapture(body, r.Header.Get("Content-Type"), cfg.captureBodyMaxBytes); capture != nil {
+						r.Body = capture
+					}
+				}
+			}
+
+			fields := &logFields{}
+
+			r = withRequestLogging(r, l, reqID, fields)
+
+			aborted := serveAbortable(h, ww, r)
+			duration := clk.Now().Sub(start)
+
+			route := routePattern(r)
+			if span.IsRecording() {
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+
+			routeAttr := metric.WithAttributes(attribute.String("route", route))
+			inst.requestBodySize.Record(r.Context(), rc.BytesRead(), routeAttr)
+			ttfb, wrote := fbw.timeToFirstByte(start)
+			if !ww.hijacked {
+				inst.responseBodySize.Record(r.Context(), int64(ww.BytesWritten()), routeAttr)
+				if wrote {
+					inst.timeToFirstByte.Record(r.Context(), ttfb.Seconds(), routeAttr)
+				}
+			}
+
+			if body.exceeded {
+				inst.bodyLimitExceeded.Add(r.Context(), 1, routeAttr)
+				l.Warn("Request body limit exceeded", slog.Int64("limit", cfg.maxAllowedRequestBytes), slog.Int64("br", rc.BytesRead()))
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("route", route),
+				slog.String("proto", r.Proto),
+				// named apart from the tls group logged with LOG_TLS_INFO so that each key keeps one type
+				slog.Bool("encrypted", r.TLS != nil),
+				slog.String("ua", r.UserAgent()),
+				slog.String("ip", r.RemoteAddr),
+				slog.Int64("br", rc.BytesRead()),
+				slog.Duration("duration", duration),
+			}
+			// once hijacked, the connection is no longer written through ww so its status and
+			// byte count would misleadingly report zeros
+			if ww.hijacked {
+				attrs = append(attrs, slog.Bool("hijacked", true))
+			} else {
+				status := fields.statusOr(ww.Status())
+				attrs = append(attrs, slog.Int("bw", ww.BytesWritten()), slog.Int("status", status))
+				if cfg.logTTFB && wrote {
+					attrs = append(attrs, slog.Duration("ttfb", ttfb))
+				}
+				markSpan(span, status, duration, cfg.otelSlowRequestThreshold)
+				if capture != nil && status >= http.StatusBadRequest {
+					attrs = append(attrs, capture.attrs(cfg.captureBodyRedactKeys)...)
+				}
+				if recent != nil && status >= http.StatusBadRequest {
+					recent.add(recentError{
+						Time:      start,
+						RequestID: reqID,
+						Method:    r.Method,
+						Path:      r.URL.Path,
+						Status:    status,
+						Error:     fields.err,
+					})
+				}
+			}
+			if cfg.logTLSInfo && r.TLS != nil {
+				attrs = append(attrs, slog.Group("tls",
+					slog.String("version", tls.VersionName(r.TLS.Version)),
+					slog.String("cipher", tls.CipherSuiteName(r.TLS.CipherSuite)),
+				))
+			}
+			if aborted {
+				attrs = append(attrs, slog.Bool("aborted", true))
+			}
+			attrs = append(attrs, fields.attrs...)
+
+			accessLogger.With(reqAttrs...).LogAttrs(r.Context(), slog.LevelInfo, "Request handled", attrs...)
+
+			onHandled()
+
+			// the abort is passed on once the request is logged, for net/http to close the connection
+			if aborted {
+				panic(http.ErrAbortHandler)
+			}
+		})
 	}
 }
 
+// drainDelay returns how long to keep serving after a shutdown signal before the server is shut down,
+// giving load balancers time to observe the failing health check. A random duration of up to jitter
+// is added so replicas signaled at the same time don't all exit in lockstep.
+func drainDelay(delay, jitter time.Duration) time.Duration {
+	if jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter)))
+	}
+
+	return delay
+}
+
+// listen listens on port, setting SO_REUSEPORT on the socket when reusePort is true. When maxConns is
+// positive, at most maxConns connections are open at once and further accepts block until one is closed.
+// When acceptsPerSecond is positive, connections are accepted at that rate with bursts of up to acceptBurst.
+func listen(port int, reusePort bool, maxConns int, acceptsPerSecond float64, acceptBurst int) (net.Listener, error) {
+	var lc net.ListenConfig
+	if reusePort {
+		lc.Control = reusePortControl
+	}
+
+	ln, err := lc.Listen(context.Background(), "tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+
+	if acceptsPerSecond > 0 {
+		ln = throttleListener(ln, acceptsPerSecond, acceptBurst)
+	}
+
+	if maxConns > 0 {
+		ln = netutil.LimitListener(ln, maxConns)
+	}
+
+	return ln, nil
+}
+
+// logListenError logs why listening on port failed, calling out the common case of the port being taken.
+func logListenError(logger *slog.Logger, port int, err error) {
+	msg := "Listening on port"
+	if errors.Is(err, syscall.EADDRINUSE) {
+		msg = "Port already in use by another process"
+	}
+
+	logger.Error(msg, slog.Int("port", port), slog.Any("error", err))
+}
+
+// serve starts serving srv on ln in the background, exiting the process if it fails for any reason
+// other than being shut down. srv serves TLS when its TLSConfig is set.
+func serve(srv *http.Server, ln net.Listener, logger *slog.Logger) {
+	go func() {
+		run := srv.Serve
+		if srv.TLSConfig != nil {
+			// the certificate is provided by TLSConfig
+			run = func(ln net.Listener) error { return srv.ServeTLS(ln, "", "") }
+		}
+
+		if err := run(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Server error", slog.String("addr", srv.Addr), slog.Any("error", err))
+			os.Exit(1)
+		}
+	}()
+}
+
 type byteReadCloser struct {
 	rc io.ReadCloser
 	n  int64
@@ -154,32 +674,72 @@ func (br *byteReadCloser) BytesRead() int64 {
 	return br.n
 }
 
+// maxRequestsSignal triggers a graceful shutdown once MAX_REQUESTS_BEFORE_RESTART requests have been handled,
+// as SIGTERM would, so that the orchestrator restarts the process.
+type maxRequestsSignal struct{}
+
+func (maxRequestsSignal) Signal() {}
+
+func (maxRequestsSignal) String() string {
+	return "max requests reached"
+}
+
 type ctxKey string
 
 const (
-	ctxKeyLogger ctxKey = "logger"
+	ctxKeyLogger            ctxKey = "logger"
+	ctxKeyLogFields         ctxKey = "logFields"
+	ctxKeyRequestID         ctxKey = "requestID"
+	ctxKeyPrincipal         ctxKey = "principal"
+	ctxKeyFeatureFlags      ctxKey = "featureFlags"
+	ctxKeyPropagatedHeaders ctxKey = "propagatedHeaders"
+	ctxKeyRequestTimeout    ctxKey = "requestTimeout"
+	ctxKeyTrustedProxy      ctxKey = "trustedProxy"
 )
 
 func getLogger(r *http.Request) *slog.Logger {
 	return r.Context().Value(ctxKeyLogger).(*slog.Logger)
 }
 
-func setLogger(r *http.Request, l *slog.Logger) *http.Request {
-	return r.WithContext(context.WithValue(r.Context(), ctxKeyLogger, l))
+func getRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(ctxKeyRequestID).(string)
+	return id
+}
+
+// withRequestLogging returns a shallow copy of r whose context carries the logger, request id, log fields, and
+// chi log entry of the request, as read by getLogger, getRequestID, getLogFields, and the recoverer.
+func withRequestLogging(r *http.Request, l *slog.Logger, reqID string, fields *logFields) *http.Request {
+	ctx := context.WithValue(r.Context(), ctxKeyLogger, l)
+	ctx = context.WithValue(ctx, ctxKeyRequestID, reqID)
+	ctx = context.WithValue(ctx, ctxKeyLogFields, fields)
+	ctx = context.WithValue(ctx, middleware.LogEntryCtxKey, newLogEntry(l, r))
+
+	return r.WithContext(ctx)
 }
 
 type logEntry struct {
 	logger *slog.Logger
+	r      *http.Request
 }
 
 var _ middleware.LogEntry = (*logEntry)(nil)
 
-func newLogEntry(logger *slog.Logger) *logEntry {
-	return &logEntry{logger}
+// newLogEntry returns the log entry of r. logger is expected to carry the request's ids.
+func newLogEntry(logger *slog.Logger, r *http.Request) *logEntry {
+	return &logEntry{logger, r}
 }
 
+// Panic logs a panic recovered while handling the request. The route pattern is looked up
+// at this point since it is only known once the request has been routed.
 func (l *logEntry) Panic(v interface{}, stack []byte) {
-	l.logger.Error("panic caught", slog.Any("panic", v), slog.String("stack", string(stack)))
+	l.logger.Error(
+		"panic caught",
+		slog.String("method", l.r.Method),
+		slog.String("path", l.r.URL.Path),
+		slog.String("route", routePattern(l.r)),
+		slog.Any("panic", v),
+		slog.String("stack", string(stack)),
+	)
 }
 
 func (l *logEntry) Write(status int, bytes int, header http.Header, elapsed time.Duration, extra interface{}) {
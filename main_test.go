@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dillonstreator/opentelemetry-go-contrib/instrumentation/net/http/otelhttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// serveLogged serves r with h behind otelhttp, using tp, and the logging middleware configured from the
+// environment, and returns the access log line of the request.
+func serveLogged(t *testing.T, tp trace.TracerProvider, h http.Handler, r *http.Request) map[string]any {
+	t.Helper()
+
+	cfg, err := newConfig()
+	if err != nil {
+		t.Fatalf("creating config: %v", err)
+	}
+
+	inst, err := newInstruments()
+	if err != nil {
+		t.Fatalf("creating instruments: %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := newLogger(&buf, slog.LevelInfo, logFormatJSON)
+
+	mw := requestLogging(cfg, logger, logger, systemClock{}, inst, nil, func() {})
+	otelhttp.NewMiddleware("test", otelhttp.WithTracerProvider(tp))(mw(h)).ServeHTTP(httptest.NewRecorder(), r)
+
+	lines := decodeLogLines(t, &buf)
+	if len(lines) != 1 || lines[0]["msg"] != "Request handled" {
+		t.Fatalf("got log lines %v, want a single access log line", lines)
+	}
+
+	return lines[0]
+}
+
+func TestRequestLoggingTraceID(t *testing.T) {
+	tests := []struct {
+		name        string
+		tp          trace.TracerProvider
+		wantTraceID bool
+	}{
+		{
+			// the global provider is a no-op when OTEL_ENABLED isn't set
+			name:        "otel disabled",
+			tp:          noop.NewTracerProvider(),
+			wantTraceID: false,
+		},
+		{
+			name:        "otel enabled",
+			tp:          sdktrace.NewTracerProvider(),
+			wantTraceID: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := serveLogged(t, tt.tp, http.NotFoundHandler(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if reqID, _ := line["reqId"].(string); reqID == "" {
+				t.Errorf("got no reqId in %v", line)
+			}
+
+			traceID, ok := line["traceId"].(string)
+			if ok != tt.wantTraceID {
+				t.Fatalf("got traceId %v, want it present: %t", line["traceId"], tt.wantTraceID)
+			}
+			if ok && len(traceID) != 32 {
+				t.Errorf("got traceId %q, want 32 hex characters", traceID)
+			}
+		})
+	}
+}
+
+func TestRequestLoggingBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       io.Reader
+		wantNoBody bool
+		wantBR     float64
+	}{
+		{
+			name:       "without body",
+			method:     http.MethodGet,
+			body:       nil,
+			wantNoBody: true,
+			wantBR:     0,
+		},
+		{
+			name:       "with body",
+			method:     http.MethodPost,
+			body:       strings.NewReader("hello"),
+			wantNoBody: false,
+			wantBR:     5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/", tt.body)
+
+			var gotNoBody bool
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotNoBody = r.Body == http.NoBody
+				io.Copy(io.Discard, r.Body)
+			})
+
+			line := serveLogged(t, noop.NewTracerProvider(), h, r)
+
+			if gotNoBody != tt.wantNoBody {
+				t.Errorf("got body http.NoBody: %t, want %t", gotNoBody, tt.wantNoBody)
+			}
+			if line["br"] != tt.wantBR {
+				t.Errorf("got br %v, want %v", line["br"], tt.wantBR)
+			}
+		})
+	}
+}
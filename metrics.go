@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+const instrumentationName = "github.com/dillonstreator/go-chi"
+
+// setupMetrics installs a global meter provider exporting to a Prometheus registry when metrics are enabled
+// and returns the handler serving the registry. The registry also exports the Go runtime and process metrics,
+// regardless of whether OTEL_ENABLED is set.
+// If it does not return an error, make sure to call shutdown for proper cleanup.
+func setupMetrics(cfg *config) (handler http.Handler, shutdown func(context.Context) error, err error) {
+	shutdown = func(context.Context) error { return nil }
+
+	if !cfg.metricsEnabled {
+		return nil, shutdown, nil
+	}
+
+	res, err := newResource(cfg.serviceName, cfg.serviceVersion, cfg.serviceInstanceID)
+	if err != nil {
+		return nil, nil, errWrap(err, "creating otel resource")
+	}
+
+	registry := prometheus.NewRegistry()
+
+	if err := registry.Register(collectors.NewGoCollector()); err != nil {
+		return nil, nil, errWrap(err, "registering go collector")
+	}
+
+	if err := registry.Register(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{})); err != nil {
+		return nil, nil, errWrap(err, "registering process collector")
+	}
+
+	exporter, err := otelprometheus.New(otelprometheus.WithRegisterer(registry))
+	if err != nil {
+		return nil, nil, errWrap(err, "creating prometheus exporter")
+	}
+
+	meterProvider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(exporter),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(meterProvider)
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{}), meterProvider.Shutdown, nil
+}
+
+// instruments holds the service's metric instruments.
+// They are no-ops unless metrics are enabled.
+type instruments struct {
+	bodyLimitExceeded metric.Int64Counter
+	requestBodySize   metric.Int64Histogram
+	responseBodySize  metric.Int64Histogram
+	requestsAbandoned metric.Int64Counter
+	requestsRejected  metric.Int64Counter
+	timeToFirstByte   metric.Float64Histogram
+}
+
+// bodySizeBuckets are the histogram bucket boundaries in bytes for body sizes, from 0 up to 16MiB.
+var bodySizeBuckets = []float64{0, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20}
+
+// latencyBuckets are the histogram bucket boundaries in seconds for latencies, from 5ms up to 10s.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+func newInstruments() (*instruments, error) {
+	meter := otel.Meter(instrumentationName)
+
+	bodyLimitExceeded, err := meter.Int64Counter(
+		"http_request_body_limit_exceeded",
+		metric.WithDescription("Number of requests whose body exceeded the maximum allowed request bytes"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	requestBodySize, err := meter.Int64Histogram(
+		"http_request_body_size",
+		metric.WithDescription("Size of request bodies read by handlers"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(bodySizeBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBodySize, err := meter.Int64Histogram(
+		"http_response_body_size",
+		metric.WithDescription("Size of response bodies written by handlers"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(bodySizeBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	requestsAbandoned, err := meter.Int64Counter(
+		"http_requests_abandoned",
+		metric.WithDescription("Number of requests whose client disconnected before they were handled"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	requestsRejected, err := meter.Int64Counter(
+		"http_requests_rejected",
+		metric.WithDescription("Number of requests rejected by a protective limit, by limiter"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	timeToFirstByte, err := meter.Float64Histogram(
+		"http_server_time_to_first_byte",
+		metric.WithDescription("Time from receiving requests until their response was first written"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instruments{
+		bodyLimitExceeded: bodyLimitExceeded,
+		requestBodySize:   requestBodySize,
+		responseBodySize:  responseBodySize,
+		requestsAbandoned: requestsAbandoned,
+		requestsRejected:  requestsRejected,
+		timeToFirstByte:   timeToFirstByte,
+	}, nil
+}
+
+// recordRejection counts r as rejected by limiter, e.g. `rate_limit`, with the requestsRejected instrument.
+// The request's context may be done, e.g. past its deadline, which the metrics SDK would drop the measurement for.
+func recordRejection(r *http.Request, counter metric.Int64Counter, limiter string) {
+	counter.Add(context.WithoutCancel(r.Context()), 1, metric.WithAttributes(
+		attribute.String("limiter", limiter),
+		attribute.String("route", routePattern(r)),
+	))
+}
+
+// routePattern returns the pattern of the route that matched r, or an empty string when none did.
+// It is only known once the request has been routed.
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return ""
+	}
+
+	// the application router is mounted at / so requests it doesn't match only match the mount itself
+	pattern := rctx.RoutePattern()
+	if pattern == "/*" {
+		return ""
+	}
+
+	return pattern
+}
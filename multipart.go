@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// multipartLimits bound the parts of the multipart/form-data bodies read with readMultipart.
+type multipartLimits struct {
+	maxFields     int
+	maxFiles      int
+	maxFieldBytes int64
+}
+
+// maxMultipart are the limits applied by readMultipart. They are set from MULTIPART_* on startup.
+var maxMultipart = multipartLimits{maxFields: 1000, maxFiles: 100, maxFieldBytes: 1000 * 1000}
+
+// readMultipart reads a multipart/form-data request body part by part, returning its form fields and passing
+// each file part to onFile as it is read so that files are never buffered. Files are discarded when onFile is nil.
+//
+// Bodies with more fields or files than maxMultipart allows, or with a field value larger than it allows, are
+// rejected with a 400 httpError as soon as the offending part is reached, without parsing the rest of the body.
+// The body as a whole is still bounded by MAX_ALLOWED_REQUEST_BYTES.
+func readMultipart(r *http.Request, onFile func(part *multipart.Part) error) (url.Values, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, newHTTPError(http.StatusBadRequest, "request body must be multipart/form-data")
+	}
+
+	fields := url.Values{}
+	var fieldCount, fileCount int
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, multipartReadError(err)
+		}
+
+		if part.FileName() != "" {
+			if fileCount++; fileCount > maxMultipart.maxFiles {
+				return nil, newHTTPError(http.StatusBadRequest, fmt.Sprintf("request body must not contain more than %d files", maxMultipart.maxFiles))
+			}
+
+			if onFile != nil {
+				if err := onFile(part); err != nil {
+					return nil, err
+				}
+			}
+
+			continue
+		}
+
+		if fieldCount++; fieldCount > maxMultipart.maxFields {
+			return nil, newHTTPError(http.StatusBadRequest, fmt.Sprintf("request body must not contain more than %d fields", maxMultipart.maxFields))
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxMultipart.maxFieldBytes+1))
+		if err != nil {
+			return nil, multipartReadError(err)
+		}
+
+		if int64(len(value)) > maxMultipart.maxFieldBytes {
+			return nil, newHTTPError(http.StatusBadRequest, fmt.Sprintf("field %q must not exceed %d bytes", part.FormName(), maxMultipart.maxFieldBytes))
+		}
+
+		fields.Add(part.FormName(), string(value))
+	}
+}
+
+// multipartReadError returns errors reading the body, such as exceeding its size limit or read deadline, wrapped
+// so that handler picks their status, and reports any other error as a malformed body.
+func multipartReadError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return errWrap(err, "reading multipart body")
+	}
+
+	return newHTTPError(http.StatusBadRequest, "request body contains malformed multipart data")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// multipartPart is a part of a multipart/form-data body built by newMultipartRequest.
+type multipartPart struct {
+	name     string
+	fileName string
+	content  string
+}
+
+func newMultipartRequest(t *testing.T, parts ...multipartPart) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		var w io.Writer
+		var err error
+		if p.fileName != "" {
+			w, err = mw.CreateFormFile(p.name, p.fileName)
+		} else {
+			w, err = mw.CreateFormField(p.name)
+		}
+		if err != nil {
+			t.Fatalf("creating part %q: %v", p.name, err)
+		}
+		io.WriteString(w, p.content)
+	}
+	mw.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestReadMultipart(t *testing.T) {
+	prev := maxMultipart
+	maxMultipart = multipartLimits{maxFields: 2, maxFiles: 1, maxFieldBytes: 5}
+	t.Cleanup(func() { maxMultipart = prev })
+
+	// no part is ever spooled to disk, whether the body is accepted or rejected
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	large := strings.Repeat("x", 10*1000*1000)
+
+	tests := []struct {
+		name       string
+		parts      []multipartPart
+		wantFields map[string]string
+		wantFiles  map[string]int
+		wantErr    string
+	}{
+		{
+			name: "within limits",
+			parts: []multipartPart{
+				{name: "a", content: "12345"},
+				{name: "b", content: "x"},
+				{name: "doc", fileName: "doc.txt", content: large},
+			},
+			wantFields: map[string]string{"a": "12345", "b": "x"},
+			wantFiles:  map[string]int{"doc.txt": len(large)},
+		},
+		{
+			name:    "oversize field",
+			parts:   []multipartPart{{name: "a", content: "123456"}},
+			wantErr: `field "a" must not exceed 5 bytes`,
+		},
+		{
+			name:    "too many fields",
+			parts:   []multipartPart{{name: "a"}, {name: "b"}, {name: "c"}},
+			wantErr: "request body must not contain more than 2 fields",
+		},
+		{
+			name: "too many files",
+			parts: []multipartPart{
+				{name: "doc", fileName: "a.txt", content: large},
+				{name: "doc", fileName: "b.txt", content: large},
+			},
+			// the file over the limit is never passed on
+			wantFiles: map[string]int{"a.txt": len(large)},
+			wantErr:   "request body must not contain more than 1 files",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]int{}
+			fields, err := readMultipart(newMultipartRequest(t, tt.parts...), func(part *multipart.Part) error {
+				n, err := io.Copy(io.Discard, part)
+				files[part.FileName()] = int(n)
+				return err
+			})
+
+			if tt.wantErr != "" {
+				var httpErr *httpError
+				if !errors.As(err, &httpErr) || httpErr.status != http.StatusBadRequest || httpErr.message != tt.wantErr {
+					t.Errorf("got error %v, want a 400 with %q", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("reading multipart body: %v", err)
+				}
+
+				for name, want := range tt.wantFields {
+					if got := fields.Get(name); got != want {
+						t.Errorf("got field %s %q, want %q", name, got, want)
+					}
+				}
+			}
+
+			if len(files) != len(tt.wantFiles) {
+				t.Errorf("got files %v, want %v", files, tt.wantFiles)
+			}
+			for name, want := range tt.wantFiles {
+				if got := files[name]; got != want {
+					t.Errorf("got %d bytes for file %s, want %d", got, name, want)
+				}
+			}
+
+			entries, err := os.ReadDir(tmp)
+			if err != nil {
+				t.Fatalf("reading temp dir: %v", err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("got %d files left in the temp dir, want none", len(entries))
+			}
+		})
+	}
+}
+
+func TestReadMultipartNotMultipart(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+	r.Header.Set("Content-Type", "application/json")
+
+	_, err := readMultipart(r, nil)
+
+	var httpErr *httpError
+	if !errors.As(err, &httpErr) || httpErr.status != http.StatusBadRequest {
+		t.Errorf("got error %v, want a 400", err)
+	}
+}
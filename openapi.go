@@ -0,0 +1,65 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi"
+)
+
+//go:embed all:api
+var embeddedAPI embed.FS
+
+// loadOpenAPISpec reads the OpenAPI document at path, or the one embedded at api/openapi.json when path is empty.
+// It returns nil without error when no document is embedded.
+func loadOpenAPISpec(path string) ([]byte, error) {
+	if path != "" {
+		spec, err := os.ReadFile(path)
+		return spec, errWrap(err, "reading openapi spec")
+	}
+
+	spec, err := fs.ReadFile(embeddedAPI, "api/openapi.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return spec, errWrap(err, "reading embedded openapi spec")
+}
+
+// mountOpenAPI serves spec at /openapi.json and, when swaggerUI is true, a Swagger UI page rendering it at /docs.
+func mountOpenAPI(r chi.Router, spec []byte, swaggerUI bool) {
+	r.With(cacheable("public, max-age=300")).Get("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	})
+
+	if swaggerUI {
+		r.Get("/docs", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(swaggerUIPage))
+		})
+	}
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at /openapi.json.
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>API documentation</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// getPrincipal returns the identifier of the authenticated principal of the request,
+// or an empty string when the request is unauthenticated.
+func getPrincipal(r *http.Request) string {
+	principal, _ := r.Context().Value(ctxKeyPrincipal).(string)
+	return principal
+}
+
+// setPrincipal records the identifier of the authenticated principal of the request.
+// Authentication middleware should call it once credentials have been validated,
+// with an identifier only and never with token or key material.
+//
+// The principal is also added to the request's span as enduser.id and to its access log line,
+// so that traces and logs can be filtered by user.
+func setPrincipal(r *http.Request, principal string) *http.Request {
+	if span := trace.SpanFromContext(r.Context()); span.IsRecording() {
+		span.SetAttributes(semconv.EnduserID(principal))
+	}
+	addLogField(r, slog.String("principal", principal))
+
+	return r.WithContext(context.WithValue(r.Context(), ctxKeyPrincipal, principal))
+}
+
+// setPrincipalRole records the role of the authenticated principal, as found in validated claims, on the
+// request's span as enduser.role and on its access log line.
+func setPrincipalRole(r *http.Request, role string) {
+	if span := trace.SpanFromContext(r.Context()); span.IsRecording() {
+		span.SetAttributes(semconv.EnduserRole(role))
+	}
+	addLogField(r, slog.String("principalRole", role))
+}
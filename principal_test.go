@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// authenticateBearer is an example authentication middleware recording the bearer token as the principal.
+// Real middleware would validate the token and record the identifier it resolves to instead.
+func authenticateBearer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			r = setPrincipal(r, token)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestPrincipal(t *testing.T) {
+	inst, err := newInstruments()
+	if err != nil {
+		t.Fatalf("creating instruments: %v", err)
+	}
+
+	clk := newFakeClock()
+	rl, err := newRateLimiter(1, 1, rateLimitKeyPrincipal, 10, time.Minute, clk, inst.requestsRejected)
+	if err != nil {
+		t.Fatalf("creating rate limiter: %v", err)
+	}
+
+	var buf bytes.Buffer
+	auditLogger := newLogger(&buf, slog.LevelInfo, logFormatJSON)
+
+	// authentication comes first, so that the audit log and the rate limiter see the principal
+	h := authenticateBearer(audit(auditLogger, clk)(rl.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))))
+
+	steps := []struct {
+		principal     string
+		wantStatus    int
+		wantPrincipal string
+	}{
+		{"alice", http.StatusOK, "alice"},
+		// alice used her bucket, bob has his own even though both come from the same IP
+		{"alice", http.StatusTooManyRequests, "alice"},
+		{"bob", http.StatusOK, "bob"},
+		// unauthenticated requests are keyed by IP
+		{"", http.StatusOK, ""},
+		{"", http.StatusTooManyRequests, ""},
+	}
+
+	for i, step := range steps {
+		buf.Reset()
+
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if step.principal != "" {
+			r.Header.Set("Authorization", "Bearer "+step.principal)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != step.wantStatus {
+			t.Errorf("step %d: got status %d, want %d", i, w.Code, step.wantStatus)
+		}
+
+		lines := decodeLogLines(t, &buf)
+		if len(lines) != 1 || lines[0]["msg"] != "Audit" {
+			t.Fatalf("step %d: got log lines %v, want a single audit record", i, lines)
+		}
+		if principal := lines[0]["principal"]; principal != step.wantPrincipal {
+			t.Errorf("step %d: got audited principal %q, want %q", i, principal, step.wantPrincipal)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// problem is an RFC 9457 problem details response body.
+type problem struct {
+	Type   string `json:"type,omitempty"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// writeProblem writes an application/problem+json response with the given status and detail.
+// The detail is recorded as the error of the request unless one was recorded already.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	writeProblemCode(w, r, status, "", detail)
+}
+
+// writeProblemCode is like writeProblem but identifies the error with code. When errorCatalog has a message
+// for code, the title and detail are localized according to the request's Accept-Language.
+func writeProblemCode(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	if detail != "" {
+		setResponseError(r, detail)
+	}
+
+	p := problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+
+	if code != "" && errorCatalog != nil {
+		w.Header().Add("Vary", "Accept-Language")
+		if msg, locale, ok := errorCatalog.lookup(code, r.Header.Get("Accept-Language")); ok {
+			w.Header().Set("Content-Language", locale.String())
+			if msg.Title != "" {
+				p.Title = msg.Title
+			}
+			if msg.Detail != "" {
+				p.Detail = msg.Detail
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/time/rate"
+)
+
+const (
+	rateLimitKeyIP        = "ip"
+	rateLimitKeyPrincipal = "principal"
+	rateLimitKeyAPIKey    = "api_key"
+	rateLimitKeyHeader    = "header:"
+
+	apiKeyHeader = "X-API-Key"
+)
+
+// rateLimiter is an in-memory token bucket rate limiter keyed per client. It tracks at most maxKeys buckets,
+// evicting the least recently used one beyond that, and sweep evicts buckets left idle for idleTTL so that
+// churning clients, e.g. scanners cycling through addresses, can't grow it without bound.
+type rateLimiter struct {
+	limit    rate.Limit
+	burst    int
+	key      func(r *http.Request) string
+	maxKeys  int
+	idleTTL  time.Duration
+	clock    clock
+	rejected metric.Int64Counter
+
+	mu sync.Mutex
+	// buckets are ordered from most to least recently used
+	buckets *list.List
+	keys    map[string]*list.Element
+}
+
+type rateLimitBucket struct {
+	key      string
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newRateLimiter returns a rateLimiter allowing rps requests per second with the given burst per key.
+// keyStrategy selects how requests are keyed, see parseRateLimitKey. Buckets are refilled according to clk.
+// The number of tracked keys is reported by the rate_limit_tracked_keys gauge, and rejections are counted by rejected.
+func newRateLimiter(rps float64, burst int, keyStrategy string, maxKeys int, idleTTL time.Duration, clk clock, rejected metric.Int64Counter) (*rateLimiter, error) {
+	rl := &rateLimiter{
+		limit:    rate.Limit(rps),
+		burst:    burst,
+		key:      rateLimitKeyFunc(keyStrategy),
+		maxKeys:  maxKeys,
+		idleTTL:  idleTTL,
+		clock:    clk,
+		rejected: rejected,
+		buckets:  list.New(),
+		keys:     map[string]*list.Element{},
+	}
+
+	_, err := otel.Meter(instrumentationName).Int64ObservableGauge(
+		"rate_limit_tracked_keys",
+		metric.WithDescription("Number of keys the in-memory rate limiter tracks a bucket for"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			rl.mu.Lock()
+			defer rl.mu.Unlock()
+
+			o.Observe(int64(len(rl.keys)))
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, errWrap(err, "creating rate limit tracked keys gauge")
+	}
+
+	return rl, nil
+}
+
+func (rl *rateLimiter) limiter(key string, now time.Time) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if e, ok := rl.keys[key]; ok {
+		b := e.Value.(*rateLimitBucket)
+		b.lastSeen = now
+		rl.buckets.MoveToFront(e)
+		return b.limiter
+	}
+
+	if rl.buckets.Len() >= rl.maxKeys {
+		rl.evict(rl.buckets.Back())
+	}
+
+	b := &rateLimitBucket{key: key, limiter: rate.NewLimiter(rl.limit, rl.burst), lastSeen: now}
+	rl.keys[key] = rl.buckets.PushFront(b)
+
+	return b.limiter
+}
+
+// sweep evicts buckets idle for longer than idleTTL every idleTTL until ctx is done.
+func (rl *rateLimiter) sweep(ctx context.Context) {
+	ticker := time.NewTicker(rl.idleTTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := rl.clock.Now().Add(-rl.idleTTL)
+
+		rl.mu.Lock()
+		for e := rl.buckets.Back(); e != nil && e.Value.(*rateLimitBucket).lastSeen.Before(cutoff); e = rl.buckets.Back() {
+			rl.evict(e)
+		}
+		rl.mu.Unlock()
+	}
+}
+
+// evict stops tracking the bucket of e. rl.mu must be held.
+func (rl *rateLimiter) evict(e *list.Element) {
+	rl.buckets.Remove(e)
+	delete(rl.keys, e.Value.(*rateLimitBucket).key)
+}
+
+// middleware rejects requests exceeding the rate limit of their key with a 429.
+func (rl *rateLimiter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := rl.clock.Now()
+		reservation := rl.limiter(rl.key(r), now).ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); !reservation.OK() || delay > 0 {
+			reservation.CancelAt(now)
+			recordRejection(r, rl.rejected, "rate_limit")
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			writeProblem(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKeyFunc returns a function extracting the rate limit key of a request for the given strategy.
+// Only values that can't be chosen freely by clients are used: the client IP, the principal recorded by
+// authentication middleware, and headers set by a trusted proxy, e.g. an API gateway having validated the
+// key. Keying on a header sent by clients directly would let them escape the limit, and evict the buckets of
+// others, by sending a new value with every request. Requests missing the value of the selected strategy
+// fall back to being keyed by client IP.
+func rateLimitKeyFunc(strategy string) func(r *http.Request) string {
+	var header string
+	switch {
+	case strategy == rateLimitKeyPrincipal:
+		return func(r *http.Request) string {
+			if principal := getPrincipal(r); principal != "" {
+				return "principal:" + principal
+			}
+
+			return "ip:" + clientIP(r)
+		}
+	case strategy == rateLimitKeyAPIKey:
+		header = apiKeyHeader
+	case strings.HasPrefix(strategy, rateLimitKeyHeader):
+		header = strings.TrimPrefix(strategy, rateLimitKeyHeader)
+	default:
+		return func(r *http.Request) string {
+			return "ip:" + clientIP(r)
+		}
+	}
+
+	return func(r *http.Request) string {
+		if value := r.Header.Get(header); value != "" && fromTrustedProxy(r) {
+			return "key:" + value
+		}
+
+		return "ip:" + clientIP(r)
+	}
+}
+
+// parseRateLimitKey validates a RATE_LIMIT_KEY strategy: `ip`, `principal`, `api_key`, or `header:<name>`.
+func parseRateLimitKey(value string) (string, error) {
+	switch {
+	case value == rateLimitKeyIP, value == rateLimitKeyPrincipal, value == rateLimitKeyAPIKey:
+		return value, nil
+	case strings.HasPrefix(value, rateLimitKeyHeader) && len(value) > len(rateLimitKeyHeader):
+		return value, nil
+	}
+
+	return "", fmt.Errorf("invalid rate limit key %q: must be one of %s, %s, %s, or %s<name>", value, rateLimitKeyIP, rateLimitKeyPrincipal, rateLimitKeyAPIKey, rateLimitKeyHeader)
+}
+
+// clientIP returns the IP of the client which, behind trusted proxies, has been resolved by trustProxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefill(t *testing.T) {
+	inst, err := newInstruments()
+	if err != nil {
+		t.Fatalf("creating instruments: %v", err)
+	}
+
+	clk := newFakeClock()
+	rl, err := newRateLimiter(2, 2, rateLimitKeyIP, 10, time.Minute, clk, inst.requestsRejected)
+	if err != nil {
+		t.Fatalf("creating rate limiter: %v", err)
+	}
+
+	h := rl.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// serve returns the status of a request and its Retry-After header
+	serve := func() (int, string) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code, w.Header().Get("Retry-After")
+	}
+
+	steps := []struct {
+		advance        time.Duration
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		// the burst is available right away
+		{0, http.StatusOK, ""},
+		{0, http.StatusOK, ""},
+		{0, http.StatusTooManyRequests, "1"},
+		// a token refills every 500ms at 2 requests per second
+		{499 * time.Millisecond, http.StatusTooManyRequests, "1"},
+		{time.Millisecond, http.StatusOK, ""},
+		{0, http.StatusTooManyRequests, "1"},
+		// the bucket doesn't refill beyond the burst
+		{time.Hour, http.StatusOK, ""},
+		{0, http.StatusOK, ""},
+		{0, http.StatusTooManyRequests, "1"},
+	}
+
+	for i, step := range steps {
+		clk.Advance(step.advance)
+
+		status, retryAfter := serve()
+		if status != step.wantStatus || retryAfter != step.wantRetryAfter {
+			t.Errorf("step %d: got status %d with Retry-After %q, want %d with %q", i, status, retryAfter, step.wantStatus, step.wantRetryAfter)
+		}
+	}
+}
+
+func TestRateLimitKeyFunc(t *testing.T) {
+	trustedProxies := parseIPs([]string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name       string
+		strategy   string
+		remoteAddr string
+		headers    map[string]string
+		principal  string
+		want       string
+	}{
+		{
+			name:       "ip",
+			strategy:   rateLimitKeyIP,
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{apiKeyHeader: "k1"},
+			want:       "ip:192.0.2.1",
+		},
+		{
+			name:       "ip behind a trusted proxy",
+			strategy:   rateLimitKeyIP,
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{xForwardedFor: "192.0.2.1"},
+			want:       "ip:192.0.2.1",
+		},
+		{
+			name:       "api key from a trusted proxy",
+			strategy:   rateLimitKeyAPIKey,
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{xForwardedFor: "192.0.2.1", apiKeyHeader: "k1"},
+			want:       "key:k1",
+		},
+		{
+			name:       "api key from a client",
+			strategy:   rateLimitKeyAPIKey,
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{apiKeyHeader: "k1"},
+			want:       "ip:192.0.2.1",
+		},
+		{
+			name:       "missing api key",
+			strategy:   rateLimitKeyAPIKey,
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{xForwardedFor: "192.0.2.1"},
+			want:       "ip:192.0.2.1",
+		},
+		{
+			name:       "header from a trusted proxy",
+			strategy:   rateLimitKeyHeader + "X-Tenant-Id",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{xForwardedFor: "192.0.2.1", "X-Tenant-Id": "t1"},
+			want:       "key:t1",
+		},
+		{
+			name:       "header from a client",
+			strategy:   rateLimitKeyHeader + "X-Tenant-Id",
+			remoteAddr: "192.0.2.1:1234",
+			headers:    map[string]string{"X-Tenant-Id": "t1"},
+			want:       "ip:192.0.2.1",
+		},
+		{
+			name:       "principal",
+			strategy:   rateLimitKeyPrincipal,
+			remoteAddr: "192.0.2.1:1234",
+			principal:  "user-1",
+			want:       "principal:user-1",
+		},
+		{
+			name:       "unauthenticated principal",
+			strategy:   rateLimitKeyPrincipal,
+			remoteAddr: "192.0.2.1:1234",
+			want:       "ip:192.0.2.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+
+			key := rateLimitKeyFunc(tt.strategy)
+
+			var got string
+			h := trustProxy(slog.Default(), trustedProxies, 0, proxyProfiles[proxyProfileGeneric])(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.principal != "" {
+					r = setPrincipal(r, tt.principal)
+				}
+				got = key(r)
+			}))
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("got key %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errNotChecked is reported for dependencies until their first background check completes.
+var errNotChecked = errors.New("not checked yet")
+
+type healthCheck struct {
+	name     string
+	check    func(ctx context.Context) error
+	required bool
+}
+
+// healthChecks are the dependency checks reported by the readiness endpoint, in registration order.
+var healthChecks []healthCheck
+
+// registerHealthCheck adds a dependency check to the readiness endpoint, typically called from an init function.
+// check should return an error when the dependency is unusable and honor ctx's deadline.
+func registerHealthCheck(name string, check func(ctx context.Context) error) {
+	healthChecks = append(healthChecks, healthCheck{name, check, true})
+}
+
+// registerOptionalHealthCheck is like registerHealthCheck but a failing check only degrades readiness
+// instead of failing it, for dependencies the service can serve requests without.
+func registerOptionalHealthCheck(name string, check func(ctx context.Context) error) {
+	healthChecks = append(healthChecks, healthCheck{name, check, false})
+}
+
+// readiness reports whether dependencies are usable. Probes get the results cached by the background
+// refresh so that frequent probes stay cheap, while deep checks run every check live.
+type readiness struct {
+	checks []healthCheck
+
+	mu      sync.RWMutex
+	results map[string]error
+}
+
+func newReadiness(checks []healthCheck) *readiness {
+	results := map[string]error{}
+	for _, c := range checks {
+		results[c.name] = errNotChecked
+	}
+
+	return &readiness{
+		checks:  checks,
+		results: results,
+	}
+}
+
+// refresh runs every check each interval, bounding each run by interval, until ctx is done.
+func (rd *readiness) refresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, interval)
+		results := rd.run(runCtx)
+		cancel()
+
+		rd.mu.Lock()
+		rd.results = results
+		rd.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs every check concurrently.
+func (rd *readiness) run(ctx context.Context) map[string]error {
+	results := make(map[string]error, len(rd.checks))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, c := range rd.checks {
+		wg.Add(1)
+		go func(c healthCheck) {
+			defer wg.Done()
+
+			err := c.check(ctx)
+
+			mu.Lock()
+			results[c.name] = err
+			mu.Unlock()
+		}(c)
+	}
+	wg.Wait()
+
+	return results
+}
+
+type readinessResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// ServeHTTP responds 503 when a required check fails and 200 otherwise, listing the cached status of each check.
+// The status is "degraded" when only optional checks fail. Since the endpoint is public, checks are only
+// reported as `ok` or `failed`, without their errors, see serveDeep.
+func (rd *readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rd.mu.RLock()
+	results := rd.results
+	rd.mu.RUnlock()
+
+	status, res := rd.report(results, false)
+	encode(w, r, status, res)
+}
+
+// serveDeep is like ServeHTTP but runs every check live and reports the errors of failing checks.
+// Running checks costs dependency calls and errors may reveal internal detail, so it is only served
+// on the admin router.
+func (rd *readiness) serveDeep(w http.ResponseWriter, r *http.Request) {
+	status, res := rd.report(rd.run(r.Context()), true)
+	encode(w, r, status, res)
+}
+
+// report returns the status code and response for results, with the errors of failing checks when detailed.
+func (rd *readiness) report(results map[string]error, detailed bool) (int, readinessResponse) {
+	status := http.StatusOK
+	res := readinessResponse{Status: "ok", Checks: map[string]string{}}
+	for _, c := range rd.checks {
+		err, ok := results[c.name]
+		if !ok {
+			continue
+		}
+
+		if err == nil {
+			res.Checks[c.name] = "ok"
+			continue
+		}
+
+		res.Checks[c.name] = "failed"
+		if detailed {
+			res.Checks[c.name] = err.Error()
+		}
+		if c.required {
+			status = http.StatusServiceUnavailable
+			res.Status = "unavailable"
+		} else if status == http.StatusOK {
+			res.Status = "degraded"
+		}
+	}
+
+	return status, res
+}
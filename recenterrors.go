@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// recentError describes a request answered with a 4xx or 5xx.
+type recentError struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// recentErrors keeps the last requests answered with an error in a ring buffer, so that on-call can see what
+// is failing when logs are lagging behind. It is safe for concurrent use.
+type recentErrors struct {
+	mu     sync.Mutex
+	errors []recentError
+	next   int
+	full   bool
+}
+
+// newRecentErrors returns a recentErrors keeping the last size errors.
+func newRecentErrors(size int) *recentErrors {
+	return &recentErrors{errors: make([]recentError, size)}
+}
+
+// add records e, replacing the oldest error once the buffer is full.
+func (re *recentErrors) add(e recentError) {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	re.errors[re.next] = e
+	re.next = (re.next + 1) % len(re.errors)
+	if re.next == 0 {
+		re.full = true
+	}
+}
+
+// list returns the recorded errors, most recent first.
+func (re *recentErrors) list() []recentError {
+	re.mu.Lock()
+	defer re.mu.Unlock()
+
+	n := re.next
+	if re.full {
+		n = len(re.errors)
+	}
+
+	list := make([]recentError, 0, n)
+	for i := 1; i <= n; i++ {
+		list = append(list, re.errors[(re.next-i+len(re.errors))%len(re.errors)])
+	}
+
+	return list
+}
+
+type recentErrorsResponse struct {
+	Errors []recentError `json:"errors"`
+}
+
+// ServeHTTP lists the recorded errors, most recent first.
+func (re *recentErrors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	encode(w, r, http.StatusOK, recentErrorsResponse{Errors: re.list()})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// recoverer recovers panics in next and logs them with the log entry of the request, answering with a 500.
+//
+// Once the response has been committed, its status can't be changed and writing an error into it would corrupt
+// it. The request is then aborted with http.ErrAbortHandler instead, which makes net/http close the connection,
+// so that the client sees the response as incomplete rather than as a complete one with an error glued to it.
+// Panics with http.ErrAbortHandler itself are deliberate aborts and are passed on as they are.
+func recoverer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		defer func() {
+			rvr := recover()
+			if rvr == nil {
+				return
+			}
+
+			if rvr == http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			if entry := middleware.GetLogEntry(r); entry != nil {
+				entry.Panic(rvr, debug.Stack())
+			} else {
+				middleware.PrintPrettyStack(rvr)
+			}
+
+			if ww.Status() != 0 {
+				setLogStatus(r, http.StatusInternalServerError)
+				panic(http.ErrAbortHandler)
+			}
+
+			// an upgraded connection has no response to write to
+			if r.Header.Get("Connection") != "Upgrade" {
+				writeProblem(ww, r, http.StatusInternalServerError, "")
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// serveAbortable serves r with h and reports whether h aborted the request by panicking with
+// http.ErrAbortHandler, so that the request can be logged before the abort is passed on. Other panics are
+// passed on right away.
+func serveAbortable(h http.Handler, w http.ResponseWriter, r *http.Request) (aborted bool) {
+	defer func() {
+		if rvr := recover(); rvr != nil {
+			if rvr != http.ErrAbortHandler {
+				panic(rvr)
+			}
+
+			aborted = true
+		}
+	}()
+
+	h.ServeHTTP(w, r)
+
+	return false
+}
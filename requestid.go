@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDGeneratorUUID     = "uuid"
+	requestIDGeneratorUUIDPool = "uuid_pool"
+)
+
+// newRequestID generates the id for requests which don't carry an acceptable one.
+// It is a package-level var so a cheaper generator can be swapped in.
+var newRequestID = uuid.NewString
+
+// parseRequestIDGenerator validates a REQUEST_ID_GENERATOR: `uuid` or `uuid_pool`.
+func parseRequestIDGenerator(value string) (string, error) {
+	switch value {
+	case requestIDGeneratorUUID, requestIDGeneratorUUIDPool:
+		return value, nil
+	}
+
+	return "", fmt.Errorf("invalid request id generator %q: must be one of %s or %s", value, requestIDGeneratorUUID, requestIDGeneratorUUIDPool)
+}
+
+// useRequestIDGenerator configures the uuid package for the given generator, which newRequestID uses.
+// `uuid_pool` draws UUID randomness from a pooled buffer instead of reading
+// crypto/rand per id, trading a little memory for fewer syscalls on the hot path.
+func useRequestIDGenerator(generator string) {
+	if generator == requestIDGeneratorUUIDPool {
+		uuid.EnableRandPool()
+		return
+	}
+
+	uuid.DisableRandPool()
+}
+
+// resolveRequestID returns the request id to use for a request given the value of its
+// x-request-id header. By default only valid UUIDs are accepted. When acceptAny is true,
+// any non-empty value of at most maxLength bytes made of characters allowed by
+// validRequestID is used as-is. A new id is generated whenever the provided value is not accepted.
+func resolveRequestID(value string, acceptAny bool, maxLength int) string {
+	if acceptAny {
+		if value != "" && len(value) <= maxLength && validRequestID(value) {
+			return value
+		}
+
+		return newRequestID()
+	}
+
+	if id, err := uuid.Parse(value); err == nil {
+		return id.String()
+	}
+
+	return newRequestID()
+}
+
+// validRequestID reports whether id only consists of ASCII letters, digits, `-`, and `_`, so that
+// client-provided ids can't inject control characters, such as newlines, or markup into logs
+// and response headers.
+func validRequestID(id string) bool {
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
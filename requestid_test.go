@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func BenchmarkRequestID(b *testing.B) {
+	for _, generator := range []string{requestIDGeneratorUUID, requestIDGeneratorUUIDPool} {
+		b.Run(generator, func(b *testing.B) {
+			useRequestIDGenerator(generator)
+			b.Cleanup(uuid.DisableRandPool)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				newRequestID()
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePortControl fails on platforms without SO_REUSEPORT.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errors.New("REUSE_PORT is not supported on this platform")
+}
@@ -0,0 +1,22 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortControl sets SO_REUSEPORT on a socket before it is bound, so that several processes can listen
+// on the same port at once.
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var err error
+	if ctrlErr := c.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}); ctrlErr != nil {
+		return ctrlErr
+	}
+
+	return errWrap(err, "setting SO_REUSEPORT")
+}
@@ -0,0 +1,15 @@
+package main
+
+import "github.com/go-chi/chi"
+
+// routeRegistrars are the functions contributing routes to the application router, in registration order.
+var routeRegistrars []func(r chi.Router)
+
+// registerRoutes adds functions contributing routes to the application router, typically called from an
+// init function so that a feature can add its routes without editing main.
+// Each function is called once at startup with its own group of the router: it inherits the base and api
+// middleware stacks and may add middleware of its own with r.Use without affecting other routes.
+// Registered routes are added after the built-in ones, in registration order.
+func registerRoutes(fns ...func(r chi.Router)) {
+	routeRegistrars = append(routeRegistrars, fns...)
+}
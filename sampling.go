@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// samplingPriority marks spans worth keeping regardless of the sample ratio, following the `sampling.priority`
+// convention collectors and tracing backends understand for tail sampling.
+const samplingPriority = attribute.Key("sampling.priority")
+
+func parseSampleRatio(value string) (float64, error) {
+	ratio, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("invalid sample ratio %q: must be between 0 and 1", value)
+	}
+
+	return ratio, nil
+}
+
+// newSampler samples ratio of new traces and follows the decision of sampled parents. Traces that aren't
+// sampled are still recorded rather than dropped, so that their spans can be kept with keepMarkedSpans once
+// their outcome is known.
+func newSampler(ratio float64) trace.Sampler {
+	return trace.ParentBased(
+		recordUnsampled{trace.TraceIDRatioBased(ratio)},
+		trace.WithRemoteParentNotSampled(recordUnsampled{trace.NeverSample()}),
+		trace.WithLocalParentNotSampled(recordUnsampled{trace.NeverSample()}),
+	)
+}
+
+// recordUnsampled turns the drop decisions of a sampler into record-only ones.
+type recordUnsampled struct {
+	trace.Sampler
+}
+
+func (s recordUnsampled) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	res := s.Sampler.ShouldSample(p)
+	if res.Decision == trace.Drop {
+		res.Decision = trace.RecordOnly
+	}
+
+	return res
+}
+
+func (s recordUnsampled) Description() string {
+	return "RecordUnsampled{" + s.Sampler.Description() + "}"
+}
+
+// maxHeldSpans bounds how many spans keepMarkedSpans holds for an unsampled trace until its local root ends.
+const maxHeldSpans = 256
+
+// keepMarkedSpans passes spans of traces that weren't sampled, but whose local root span was marked with
+// samplingPriority, on to the wrapped processor as if they were sampled, so that they are exported. Since
+// the mark is only known once the local root ends, spans ending before it are held until then. Other
+// unsampled spans are dropped by the wrapped processor as usual.
+type keepMarkedSpans struct {
+	trace.SpanProcessor
+
+	mu   sync.Mutex
+	held map[oteltrace.TraceID][]trace.ReadOnlySpan
+}
+
+func newKeepMarkedSpans(next trace.SpanProcessor) *keepMarkedSpans {
+	return &keepMarkedSpans{SpanProcessor: next, held: map[oteltrace.TraceID][]trace.ReadOnlySpan{}}
+}
+
+func (p *keepMarkedSpans) OnStart(parent context.Context, s trace.ReadWriteSpan) {
+	if !s.SpanContext().IsSampled() && localRoot(s) {
+		p.mu.Lock()
+		p.held[s.SpanContext().TraceID()] = nil
+		p.mu.Unlock()
+	}
+
+	p.SpanProcessor.OnStart(parent, s)
+}
+
+func (p *keepMarkedSpans) OnEnd(s trace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		p.SpanProcessor.OnEnd(s)
+		return
+	}
+
+	traceID := s.SpanContext().TraceID()
+
+	p.mu.Lock()
+	held, ok := p.held[traceID]
+	if !localRoot(s) {
+		// spans ending after their local root are dropped, it is no longer known whether to keep them
+		if ok && len(held) < maxHeldSpans {
+			p.held[traceID] = append(held, s)
+		}
+		p.mu.Unlock()
+		return
+	}
+	delete(p.held, traceID)
+	p.mu.Unlock()
+
+	if !marked(s) {
+		return
+	}
+
+	for _, h := range held {
+		p.SpanProcessor.OnEnd(sampledSpan{h})
+	}
+	p.SpanProcessor.OnEnd(sampledSpan{s})
+}
+
+// localRoot reports whether s is the first span of its trace in this process.
+func localRoot(s trace.ReadOnlySpan) bool {
+	parent := s.Parent()
+	return !parent.IsValid() || parent.IsRemote()
+}
+
+func marked(s trace.ReadOnlySpan) bool {
+	for _, attr := range s.Attributes() {
+		if attr.Key == samplingPriority {
+			return attr.Value.AsInt64() > 0
+		}
+	}
+
+	return false
+}
+
+// sampledSpan reports a span as sampled.
+type sampledSpan struct {
+	trace.ReadOnlySpan
+}
+
+func (s sampledSpan) SpanContext() oteltrace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
+
+// markSpan marks span to be kept when the request failed with a server error or took at least slowThreshold,
+// so that the requests worth debugging are traced even with a low sample ratio. A zero slowThreshold only
+// marks server errors.
+func markSpan(span oteltrace.Span, status int, duration, slowThreshold time.Duration) {
+	if !span.IsRecording() {
+		return
+	}
+
+	if status >= http.StatusInternalServerError || (slowThreshold > 0 && duration >= slowThreshold) {
+		span.SetAttributes(samplingPriority.Int(1))
+	}
+}
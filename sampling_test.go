@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestKeepMarkedSpans(t *testing.T) {
+	tests := []struct {
+		name   string
+		ratio  float64
+		status int
+		want   []string
+	}{
+		{
+			name:   "sampled",
+			ratio:  1,
+			status: http.StatusOK,
+			want:   []string{"child", "grandchild", "server"},
+		},
+		{
+			name:   "unsampled",
+			ratio:  0,
+			status: http.StatusOK,
+			want:   nil,
+		},
+		{
+			name:   "unsampled but marked",
+			ratio:  0,
+			status: http.StatusInternalServerError,
+			want:   []string{"child", "grandchild", "server"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			processor := newKeepMarkedSpans(sdktrace.NewSimpleSpanProcessor(exporter))
+			tp := sdktrace.NewTracerProvider(
+				sdktrace.WithSampler(newSampler(tt.ratio)),
+				sdktrace.WithSpanProcessor(processor),
+			)
+			tracer := tp.Tracer("test")
+
+			ctx, server := tracer.Start(context.Background(), "server")
+			ctx, child := tracer.Start(ctx, "child")
+			_, grandchild := tracer.Start(ctx, "grandchild")
+			grandchild.End()
+			child.End()
+			markSpan(server, tt.status, 0, 0)
+			server.End()
+
+			var got []string
+			for _, s := range exporter.GetSpans() {
+				if !s.SpanContext.IsSampled() {
+					t.Errorf("got span %s exported as unsampled", s.Name)
+				}
+				got = append(got, s.Name)
+			}
+			sort.Strings(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got exported spans %v, want %v", got, tt.want)
+			}
+
+			if n := len(processor.held); n != 0 {
+				t.Errorf("got spans of %d traces still held, want none", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+// servedByHeader identifies the deployment which served a response, e.g. `go-chi@v1.0.0/pod-1`.
+const servedByHeader = "X-Served-By"
+
+// servedBy returns the X-Served-By header value: the service name and version, followed by the
+// instance id when set.
+func servedBy(serviceName, serviceVersion, instanceID string) string {
+	value := serviceName + "@" + serviceVersion
+	if instanceID != "" {
+		value += "/" + instanceID
+	}
+
+	return value
+}
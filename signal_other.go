@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+var goroutineDumpSignal os.Signal
+
+var logReopenSignals []os.Signal
+
+var certReloadSignals []os.Signal
@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// goroutineDumpSignal triggers a goroutine dump to the log when admin endpoints are enabled.
+var goroutineDumpSignal os.Signal = syscall.SIGUSR1
+
+// logReopenSignals trigger reopening log files, as sent by log rotation tools such as logrotate.
+var logReopenSignals = []os.Signal{syscall.SIGHUP, syscall.SIGUSR2}
+
+// certReloadSignals trigger reloading the TLS certificate from disk.
+var certReloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+const (
+	trailingSlashExact    = "exact"
+	trailingSlashStrip    = "strip"
+	trailingSlashRedirect = "redirect"
+)
+
+// parseTrailingSlash validates a TRAILING_SLASH: `exact`, `strip`, or `redirect`.
+func parseTrailingSlash(value string) (string, error) {
+	switch value {
+	case trailingSlashExact, trailingSlashStrip, trailingSlashRedirect:
+		return value, nil
+	}
+
+	return "", fmt.Errorf("invalid trailing slash handling %q: must be one of %s, %s, or %s", value, trailingSlashExact, trailingSlashStrip, trailingSlashRedirect)
+}
+
+// trailingSlash normalizes request paths ending in a slash according to mode. `strip` routes `/foo/` as
+// `/foo`, `redirect` permanently redirects `/foo/` to `/foo`, and `exact` leaves paths as they are.
+func trailingSlash(mode string) func(http.Handler) http.Handler {
+	switch mode {
+	case trailingSlashStrip:
+		return middleware.StripSlashes
+	case trailingSlashRedirect:
+		return redirectSlashes
+	}
+
+	return func(next http.Handler) http.Handler {
+		return next
+	}
+}
+
+// redirectSlashes redirects requests whose path ends in a slash to the path without it. Unlike chi's
+// RedirectSlashes it responds with 308 so that clients repeat the method and body, and the location is
+// relative so that it doesn't depend on the Host header.
+func redirectSlashes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		if len(path) <= 1 || !strings.HasSuffix(path, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// collapse leading slashes so that e.g. `//example.com/` can't redirect to another host
+		path = "/" + strings.TrimLeft(strings.TrimRight(path, "/"), "/")
+		location := (&url.URL{Path: path, RawQuery: r.URL.RawQuery}).RequestURI()
+
+		http.Redirect(w, r, location, http.StatusPermanentRedirect)
+	})
+}
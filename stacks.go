@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Names of the base stack middleware for DISABLE_MIDDLEWARE.
+const (
+	middlewareRecoverer       = "recoverer"
+	middlewareDrain           = "drain"
+	middlewareTrustProxy      = "trustproxy"
+	middlewareOtel            = "otel"
+	middlewareLogging         = "logging"
+	middlewareBodyReadTimeout = "bodyreadtimeout"
+	middlewareFeatureFlags    = "featureflags"
+	middlewareTrailingSlash   = "trailingslash"
+	middlewareBodyLimit       = "bodylimit"
+	middlewareTimeout         = "timeout"
+)
+
+// disableableMiddleware are the base stack middleware that always run unless named in DISABLE_MIDDLEWARE. Others
+// are enabled by their own settings. The logging middleware is accepted but never disabled, see main.
+var disableableMiddleware = []string{
+	middlewareRecoverer,
+	middlewareDrain,
+	middlewareTrustProxy,
+	middlewareOtel,
+	middlewareLogging,
+	middlewareBodyReadTimeout,
+	middlewareFeatureFlags,
+	middlewareTrailingSlash,
+	middlewareBodyLimit,
+	middlewareTimeout,
+}
+
+// parseDisabledMiddleware parses DISABLE_MIDDLEWARE as a comma separated list of disableableMiddleware.
+func parseDisabledMiddleware(value string) (map[string]bool, error) {
+	names, _ := parseStringSlice(value)
+
+	disabled := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if !slices.Contains(disableableMiddleware, name) {
+			return nil, fmt.Errorf("invalid middleware %q: must be one of %s", name, strings.Join(disableableMiddleware, ", "))
+		}
+
+		disabled[name] = true
+	}
+
+	return disabled, nil
+}
+
+// apiMiddleware returns the middleware that application routes go through on top of the base stack shared by
+// every route: audit logging, rate limiting, per client in-flight limits, the concurrency limit, debug echoes,
+// and content type checks, each when enabled, and skipping abandoned requests. Probes are kept out of it so that
+// they are never rate limited or rejected. Middleware meant for application routes only belongs here as well.
+// Authentication goes first, so that the audit log and the rate limiter see the principal it records with
+// setPrincipal. Background work, such as sweeping idle rate limit buckets, runs until ctx is done.
+func apiMiddleware(ctx context.Context, cfg *config, clk clock, inst *instruments) ([]func(http.Handler) http.Handler, error) {
+	var mws []func(http.Handler) http.Handler
+
+	// authentication middleware goes here, ahead of the audit log and the rate limiter
+
+	if cfg.auditEnabled {
+		mws = append(mws, audit(newLogger(os.Stdout, slog.LevelInfo, cfg.logFormat).With("log", "audit"), clk))
+	}
+
+	if cfg.rateLimitRPS > 0 {
+		rl, err := newRateLimiter(cfg.rateLimitRPS, cfg.rateLimitBurst, cfg.rateLimitKey, cfg.rateLimitMaxKeys, cfg.rateLimitIdleTTL, clk, inst.requestsRejected)
+		if err != nil {
+			return nil, errWrap(err, "creating rate limiter")
+		}
+		go rl.sweep(ctx)
+
+		mws = append(mws, rl.middleware)
+	}
+
+	if cfg.maxInFlightPerIP > 0 {
+		mws = append(mws, newInFlightLimiter(cfg.maxInFlightPerIP, inst.requestsRejected).middleware)
+	}
+
+	// after the per client limits, so that a single client can't fill the queue shared by all
+	if cfg.concurrencyLimit > 0 {
+		cl, err := newConcurrencyLimiter(cfg.concurrencyLimit, cfg.concurrencyMaxQueue, clk, inst.requestsRejected, inst.requestsAbandoned)
+		if err != nil {
+			return nil, errWrap(err, "creating concurrency limiter")
+		}
+
+		mws = append(mws, cl.middleware)
+	}
+
+	if cfg.debugEchoEnabled {
+		mws = append(mws, debugEcho(cfg.debugEchoSecret))
+	}
+
+	if len(cfg.requiredContentTypes) > 0 {
+		mws = append(mws, requireContentType(cfg.requiredContentTypes...))
+	}
+
+	// last, so that requests abandoned while waiting on the middleware above are caught
+	mws = append(mws, skipAbandoned(inst.requestsAbandoned))
+
+	return mws, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+// startupSummary describes the effective runtime configuration, so that operators can tell at a glance which
+// features are on without going through the environment. tracing reports whether the OpenTelemetry pipeline
+// was set up, which may not be the case with OTEL_FAIL_OPEN even though OTEL_ENABLED is true.
+func startupSummary(cfg *config, tracing bool) []slog.Attr {
+	opsPort := cfg.port
+	if cfg.adminPort != 0 {
+		opsPort = cfg.adminPort
+	}
+
+	otelAttrs := []any{slog.Bool("enabled", tracing)}
+	if tracing {
+		exporter := "stdout"
+		if cfg.otelExporterOTLPEndpoint != nil {
+			exporter = cfg.otelExporterOTLPEndpoint.String()
+		}
+		otelAttrs = append(otelAttrs, slog.String("exporter", exporter), slog.Float64("sampleRatio", cfg.otelSampleRatio))
+	}
+
+	rateLimitAttrs := []any{slog.Bool("enabled", cfg.rateLimitRPS > 0)}
+	if cfg.rateLimitRPS > 0 {
+		rateLimitAttrs = append(rateLimitAttrs, slog.Float64("rps", cfg.rateLimitRPS), slog.Int("burst", cfg.rateLimitBurst), slog.String("key", cfg.rateLimitKey))
+	}
+
+	trustProxy := "ignored"
+	if cfg.trustProxyEnabled && !cfg.disabledMiddleware[middlewareTrustProxy] {
+		trustProxy = "trusted"
+	}
+
+	https := "off"
+	if cfg.httpsRedirect {
+		https = "redirect"
+	} else if cfg.httpsRequire {
+		https = "require"
+	}
+
+	featureFlags := []string{}
+	for name, on := range cfg.featureFlags {
+		if on {
+			featureFlags = append(featureFlags, name)
+		}
+	}
+	slices.Sort(featureFlags)
+
+	disabledMiddleware := []string{}
+	for name := range cfg.disabledMiddleware {
+		disabledMiddleware = append(disabledMiddleware, name)
+	}
+	slices.Sort(disabledMiddleware)
+
+	return []slog.Attr{
+		slog.Bool("tls", cfg.tlsCertFile != ""),
+		slog.Group("otel", otelAttrs...),
+		slog.Bool("metrics", cfg.metricsEnabled),
+		slog.Group("rateLimit", rateLimitAttrs...),
+		slog.String("proxyHeaders", trustProxy),
+		slog.String("proxyProfile", cfg.proxyProfile),
+		slog.String("https", https),
+		slog.Bool("compression", cfg.gzipEnabled),
+		slog.Bool("cors", len(cfg.corsAllowedOrigins) > 0),
+		slog.Bool("admin", cfg.adminEnabled),
+		slog.Group("endpoints",
+			slog.String("health", fmt.Sprintf(":%d%s", cfg.port, cfg.healthEndpoint)),
+			slog.String("ready", fmt.Sprintf(":%d/readyz", cfg.port)),
+			slog.String("ops", fmt.Sprintf(":%d", opsPort)),
+		),
+		slog.Any("featureFlags", featureFlags),
+		slog.Any("disabledMiddleware", disabledMiddleware),
+	}
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"context"
 	"errors"
+	"net"
+	"net/url"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
@@ -13,7 +16,7 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
-// setupOTelSDK bootstraps the OpenTelemetry pipeline.
+// setupOTelSDK bootstraps the OpenTelemetry pipeline, giving up with an error once ctx is done.
 // If it does not return an error, make sure to call shutdown for proper cleanup.
 func setupOTelSDK(ctx context.Context, cfg *config) (shutdown func(context.Context) error, err error) {
 	var shutdownFuncs []func(context.Context) error
@@ -40,9 +43,9 @@ func setupOTelSDK(ctx context.Context, cfg *config) (shutdown func(context.Conte
 	}
 
 	// Set up resource.
-	res, err := newResource(cfg.serviceName, cfg.serviceVersion)
+	res, err := newResource(cfg.serviceName, cfg.serviceVersion, cfg.serviceInstanceID)
 	if err != nil {
-		handleErr(err)
+		handleErr(errWrap(err, "creating otel resource"))
 		return
 	}
 
@@ -51,9 +54,9 @@ func setupOTelSDK(ctx context.Context, cfg *config) (shutdown func(context.Conte
 	otel.SetTextMapPropagator(prop)
 
 	// Set up trace provider.
-	tracerProvider, err := newTraceProvider(res, cfg)
+	tracerProvider, err := newTraceProviderContext(ctx, res, cfg)
 	if err != nil {
-		handleErr(err)
+		handleErr(errWrap(err, "creating otel trace provider"))
 		return
 	}
 	shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
@@ -62,12 +65,17 @@ func setupOTelSDK(ctx context.Context, cfg *config) (shutdown func(context.Conte
 	return
 }
 
-func newResource(serviceName, serviceVersion string) (*resource.Resource, error) {
+func newResource(serviceName, serviceVersion, serviceInstanceID string) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(serviceVersion),
+	}
+	if serviceInstanceID != "" {
+		attrs = append(attrs, semconv.ServiceInstanceID(serviceInstanceID))
+	}
+
 	return resource.Merge(resource.Default(),
-		resource.NewWithAttributes(semconv.SchemaURL,
-			semconv.ServiceName(serviceName),
-			semconv.ServiceVersion(serviceVersion),
-		))
+		resource.NewWithAttributes(semconv.SchemaURL, attrs...))
 }
 
 func newPropagator() propagation.TextMapPropagator {
@@ -77,23 +85,80 @@ func newPropagator() propagation.TextMapPropagator {
 	)
 }
 
-func newTraceProvider(res *resource.Resource, cfg *config) (*trace.TracerProvider, error) {
+// newTraceProviderContext is like newTraceProvider but returns ctx's error once ctx is done, in case creating
+// the exporter blocks. A provider created after that is shut down.
+func newTraceProviderContext(ctx context.Context, res *resource.Resource, cfg *config) (*trace.TracerProvider, error) {
+	type result struct {
+		tracerProvider *trace.TracerProvider
+		err            error
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		tracerProvider, err := newTraceProvider(ctx, res, cfg)
+		done <- result{tracerProvider, err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.tracerProvider, res.err
+	case <-ctx.Done():
+		go func() {
+			if res := <-done; res.tracerProvider != nil {
+				res.tracerProvider.Shutdown(context.Background())
+			}
+		}()
+
+		return nil, ctx.Err()
+	}
+}
+
+// newTraceProvider exports spans to the OTLP endpoint when one is configured and to standard output otherwise,
+// sampling them as described by newSampler.
+func newTraceProvider(ctx context.Context, res *resource.Resource, cfg *config) (*trace.TracerProvider, error) {
 	var exporter trace.SpanExporter
 	var err error
 	if cfg.otelExporterOTLPEndpoint != nil {
-		exporter, err = otlptracehttp.New(context.Background())
+		exporter, err = otlptracehttp.New(ctx)
+		err = errWrapf(err, "creating OTLP trace exporter for OTEL_EXPORTER_OTLP_ENDPOINT %s", cfg.otelExporterOTLPEndpoint)
 	} else {
 		exporter, err = stdouttrace.New(
 			stdouttrace.WithPrettyPrint())
+		err = errWrap(err, "creating stdout trace exporter (OTEL_EXPORTER_OTLP_ENDPOINT is not set)")
 	}
 	if err != nil {
 		return nil, err
 	}
 
+	// unsampled spans are recorded so that those marked by markSpan once the request is over can still be exported
 	traceProvider := trace.NewTracerProvider(
-		trace.WithBatcher(exporter),
+		trace.WithSampler(newSampler(cfg.otelSampleRatio)),
+		trace.WithSpanProcessor(newKeepMarkedSpans(trace.NewBatchSpanProcessor(exporter))),
 		trace.WithResource(res),
 	)
 
 	return traceProvider, nil
 }
+
+// otlpHealthCheck checks that a TCP connection can be opened to the OTLP endpoint. It doesn't export
+// anything, so a reachable endpoint rejecting exports still passes.
+func otlpHealthCheck(endpoint *url.URL) func(ctx context.Context) error {
+	port := endpoint.Port()
+	if port == "" {
+		port = "80"
+		if endpoint.Scheme == "https" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(endpoint.Hostname(), port)
+
+	return func(ctx context.Context) error {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return errWrapf(err, "dialing OTLP endpoint %s", addr)
+		}
+
+		return conn.Close()
+	}
+}
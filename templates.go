@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// loadTemplates parses all *.html templates in dir into a single template set.
+// When dir is empty the templates embedded in the binary are used.
+func loadTemplates(dir string) (*template.Template, error) {
+	var fsys fs.FS
+	if dir != "" {
+		fsys = os.DirFS(dir)
+	} else {
+		sub, err := fs.Sub(embeddedTemplates, "templates")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	tmpl, err := template.ParseFS(fsys, "*.html")
+	if err != nil {
+		return nil, errWrap(err, "parsing templates")
+	}
+
+	return tmpl, nil
+}
+
+// renderTemplate executes the named template from tmpl and writes it as an HTML response.
+// The template is executed into a buffer first so that an execution error results in a 500
+// instead of a partially written page.
+func renderTemplate(w http.ResponseWriter, r *http.Request, tmpl *template.Template, name string, data any) {
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		getLogger(r).Error("Rendering template", slog.String("template", name), slog.Any("error", err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// requestTimeoutHeader carries the time budget a trusted proxy grants the request, as a duration such as `2.5s`.
+// trustProxy strips it from requests that don't come from a trusted proxy.
+const requestTimeoutHeader = "X-Request-Timeout"
+
+// requestTimeout bounds the request context with a deadline of timeout, or of the X-Request-Timeout
+// header when it is shorter. A zero timeout returns next unchanged. Routes can override timeout with the
+// timeout middleware.
+//
+// The deadline is not enforced on the response: handlers and the outbound calls they make with the
+// request context are expected to honor it, see remaining. WebSocket upgrades are long-lived by design
+// and are passed through without a deadline.
+func requestTimeout(timeout time.Duration, clk clock) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := newTimeoutContext(r.Context(), clk)
+			defer ctx.stop()
+			ctx.reset(requestBudget(r, timeout))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// timeout overrides the timeout of requestTimeout for the routes it is applied to, e.g.
+// `r.With(timeout(time.Minute)).Get("/reports", ...)`, whether d is tighter or looser. When applied at
+// several levels, such as a group and one of its routes, the innermost one wins. A zero d removes the
+// timeout, e.g. for streaming routes. The X-Request-Timeout header still applies when shorter.
+//
+// The override takes effect as the request is routed. Contexts derived from the request context before
+// then keep the deadline they were created with.
+func timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if ctx, ok := r.Context().Value(ctxKeyRequestTimeout).(*timeoutContext); ok {
+				ctx.reset(requestBudget(r, d))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// without requestTimeout in front, the route sets up its own deadline
+			requestTimeout(d, systemClock{})(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestBudget returns timeout, or the duration of the X-Request-Timeout header when it is shorter.
+// It returns zero when neither applies.
+func requestBudget(r *http.Request, timeout time.Duration) time.Duration {
+	if hd, err := time.ParseDuration(r.Header.Get(requestTimeoutHeader)); err == nil && hd > 0 && (timeout <= 0 || hd < timeout) {
+		return hd
+	}
+
+	return timeout
+}
+
+// timeoutContext is a context whose deadline can be moved, or removed, as long as the request is routed.
+// Once the deadline passes it is done with context.DeadlineExceeded, like a context created with
+// context.WithDeadline.
+//
+// The context answers ctxKeyRequestTimeout itself, rather than being wrapped with context.WithValue, and
+// looks other values up in the parent rather than in the internal cancelable context. Contexts derived from
+// it are then canceled through AfterFunc with its own Err, instead of being attached to the internal context,
+// which would cancel them with context.Canceled, or watched by a goroutine each.
+type timeoutContext struct {
+	parent context.Context
+	inner  context.Context
+	cancel context.CancelCauseFunc
+	clk    clock
+	start  time.Time
+
+	mu       sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+}
+
+func newTimeoutContext(parent context.Context, clk clock) *timeoutContext {
+	inner, cancel := context.WithCancelCause(parent)
+	return &timeoutContext{parent: parent, inner: inner, cancel: cancel, clk: clk, start: clk.Now()}
+}
+
+// reset sets the deadline to d after the request started, or removes it when d is zero.
+func (c *timeoutContext) reset(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	if d <= 0 {
+		c.deadline = time.Time{}
+		return
+	}
+
+	c.deadline = c.start.Add(d)
+	c.timer = time.AfterFunc(c.deadline.Sub(c.clk.Now()), func() {
+		c.cancel(context.DeadlineExceeded)
+	})
+}
+
+// stop releases the context's resources once the request has been handled.
+func (c *timeoutContext) stop() {
+	c.reset(0)
+	c.cancel(context.Canceled)
+}
+
+func (c *timeoutContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if parent, ok := c.parent.Deadline(); ok && (c.deadline.IsZero() || parent.Before(c.deadline)) {
+		return parent, true
+	}
+
+	return c.deadline, !c.deadline.IsZero()
+}
+
+func (c *timeoutContext) Done() <-chan struct{} {
+	return c.inner.Done()
+}
+
+func (c *timeoutContext) Err() error {
+	err := c.inner.Err()
+	if err != nil && errors.Is(context.Cause(c.inner), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
+
+func (c *timeoutContext) Value(key any) any {
+	if key == ctxKeyRequestTimeout {
+		return c
+	}
+
+	return c.parent.Value(key)
+}
+
+// AfterFunc lets the context package propagate cancellation to derived contexts without a goroutine each.
+// The context package only uses it when the context is the direct parent of the derived one.
+func (c *timeoutContext) AfterFunc(f func()) func() bool {
+	return context.AfterFunc(c.inner, f)
+}
+
+// remaining returns the time left before ctx's deadline so handlers can skip optional work when little
+// time is left. It returns the maximum duration when ctx has no deadline.
+func remaining(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Until(deadline)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		header       string
+		wantDeadline time.Duration
+	}{
+		{
+			name:    "disabled",
+			timeout: 0,
+			header:  "1s",
+		},
+		{
+			name:         "timeout",
+			timeout:      time.Second,
+			wantDeadline: time.Second,
+		},
+		{
+			name:         "shorter header",
+			timeout:      time.Second,
+			header:       "250ms",
+			wantDeadline: 250 * time.Millisecond,
+		},
+		{
+			name:         "longer header",
+			timeout:      time.Second,
+			header:       "5s",
+			wantDeadline: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := newFakeClock()
+			start := clk.Now()
+
+			var (
+				deadline      time.Time
+				ok, inContext bool
+			)
+			h := requestTimeout(tt.timeout, clk)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				// the deadline is removed once the request has been handled
+				deadline, ok = r.Context().Deadline()
+				_, inContext = r.Context().Value(ctxKeyRequestTimeout).(*timeoutContext)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(requestTimeoutHeader, tt.header)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if ok != (tt.wantDeadline > 0) {
+				t.Fatalf("got deadline %v, want one: %t", deadline, tt.wantDeadline > 0)
+			}
+			if ok && !deadline.Equal(start.Add(tt.wantDeadline)) {
+				t.Errorf("got deadline %v after start, want %v", deadline.Sub(start), tt.wantDeadline)
+			}
+
+			if inContext != (tt.timeout > 0) {
+				t.Errorf("got request timeout in context: %t, want %t", inContext, tt.timeout > 0)
+			}
+		})
+	}
+}
+
+func TestRequestTimeoutDeadlineExceeded(t *testing.T) {
+	var derived context.Context
+	h := requestTimeout(10*time.Millisecond, newFakeClock())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the handler gets the timeout context itself, so that derived contexts are canceled through its AfterFunc
+		if _, ok := r.Context().(*timeoutContext); !ok {
+			t.Errorf("got request context %T, want *timeoutContext", r.Context())
+		}
+
+		var cancel context.CancelFunc
+		derived, cancel = context.WithCancel(r.Context())
+		defer cancel()
+
+		select {
+		case <-derived.Done():
+		case <-time.After(time.Second):
+			t.Error("derived context not done after the deadline")
+		}
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if err := derived.Err(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got derived context error %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+)
+
+// certReloader serves a TLS certificate which can be reloaded from disk without restarting the server,
+// so that rotated certificates (e.g. by cert-manager) are picked up without dropping connections.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// reload loads the certificate and key from disk, keeping the current certificate when they can't be loaded.
+func (cr *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return errWrapf(err, "loading TLS certificate %s and key %s", cr.certFile, cr.keyFile)
+	}
+
+	cr.cert.Store(&cert)
+
+	return nil
+}
+
+// getCertificate is a tls.Config.GetCertificate callback returning the current certificate,
+// so that handshakes after a reload use the new certificate while established connections are unaffected.
+func (cr *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return cr.cert.Load(), nil
+}
+
+// reloadOnSignal reloads the certificate whenever one of certReloadSignals is received.
+// It is a no-op on platforms without reload signals.
+func (cr *certReloader) reloadOnSignal(logger *slog.Logger) {
+	if len(certReloadSignals) == 0 {
+		return
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, certReloadSignals...)
+
+	go func() {
+		for sig := range sigs {
+			if err := cr.reload(); err != nil {
+				logger.Error("Reloading TLS certificate, keeping the current one", slog.String("signal", sig.String()), slog.Any("error", err))
+				continue
+			}
+
+			logger.Info("Reloaded TLS certificate", slog.String("signal", sig.String()))
+		}
+	}()
+}
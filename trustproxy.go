@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"net/netip"
+	"net/url"
 	"strings"
 )
 
@@ -19,24 +22,82 @@ var trustedIPs = []string{
 }
 var parsedTrustedIPs = parseIPs(trustedIPs)
 
-var proxyIPHeaders = []string{
-	"X-Envoy-External-Address",
-	"X-Forwarded-For",
-	"X-Real-IP",
-	"True-Client-IP",
+const (
+	xForwardedFor   = "X-Forwarded-For"
+	xForwardedProto = "X-Forwarded-Proto"
+	xForwardedHost  = "X-Forwarded-Host"
+)
+
+// proxyHeaders lists the headers a proxy resolves the client IP, scheme, and host in, each in order of
+// precedence. The first header present wins.
+type proxyHeaders struct {
+	ip     []string
+	scheme []string
+	host   []string
 }
 
-var schemeHeaders = []string{
-	"X-Forwarded-Proto",
-	"X-Forwarded-Scheme",
+const (
+	proxyProfileGeneric    = "generic"
+	proxyProfileCloudflare = "cloudflare"
+	proxyProfileAWSALB     = "aws-alb"
+	proxyProfileGCP        = "gcp"
+	proxyProfileNginx      = "nginx"
+	proxyProfileEnvoy      = "envoy"
+	proxyProfileFly        = "fly"
+	proxyProfileCustom     = "custom"
+)
+
+// proxyProfiles holds the headers set by common proxies and load balancers. Profiles only list the headers
+// their proxy sets, since a header it passes through untouched can be forged by clients. Proxies that keep the
+// Host header of the client have no host headers.
+var proxyProfiles = map[string]proxyHeaders{
+	proxyProfileGeneric: {
+		ip:     []string{"X-Envoy-External-Address", xForwardedFor, "X-Real-IP", "True-Client-IP"},
+		scheme: []string{xForwardedProto, "X-Forwarded-Scheme"},
+		host:   []string{xForwardedHost},
+	},
+	proxyProfileCloudflare: {
+		ip:     []string{"CF-Connecting-IP"},
+		scheme: []string{xForwardedProto},
+	},
+	proxyProfileAWSALB: {
+		ip:     []string{xForwardedFor},
+		scheme: []string{xForwardedProto},
+	},
+	proxyProfileGCP: {
+		ip:     []string{xForwardedFor},
+		scheme: []string{xForwardedProto},
+	},
+	proxyProfileNginx: {
+		ip:     []string{"X-Real-IP", xForwardedFor},
+		scheme: []string{xForwardedProto},
+		host:   []string{xForwardedHost},
+	},
+	proxyProfileEnvoy: {
+		ip:     []string{"X-Envoy-External-Address", xForwardedFor},
+		scheme: []string{xForwardedProto},
+	},
+	proxyProfileFly: {
+		ip:     []string{"Fly-Client-IP", xForwardedFor},
+		scheme: []string{xForwardedProto},
+	},
 }
 
-var xForwardedHost = "X-Forwarded-Host"
+func parseProxyProfile(value string) (string, error) {
+	if _, ok := proxyProfiles[value]; ok || value == proxyProfileCustom {
+		return value, nil
+	}
+
+	return "", fmt.Errorf("invalid proxy profile %q: must be one of %s, %s, %s, %s, %s, %s, %s, or %s", value,
+		proxyProfileGeneric, proxyProfileCloudflare, proxyProfileAWSALB, proxyProfileGCP, proxyProfileNginx, proxyProfileEnvoy, proxyProfileFly, proxyProfileCustom)
+}
 
-func trustProxy(logger *slog.Logger) func(http.Handler) http.Handler {
+// trustProxy resolves the client IP, host, and scheme from the proxy headers in headers for requests coming
+// from trustedIPs. hopCount selects the X-Forwarded-For entry of the client IP, see getRealIP.
+func trustProxy(logger *slog.Logger, trustedIPs []netip.Prefix, hopCount int, headers proxyHeaders) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			trusted, err := isTrustedIP(r.RemoteAddr, parsedTrustedIPs)
+			trusted, err := isTrustedIP(r.RemoteAddr, trustedIPs)
 			if err != nil {
 				logger.Error(err.Error(), slog.String("ip", r.RemoteAddr))
 				http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -44,20 +105,30 @@ func trustProxy(logger *slog.Logger) func(http.Handler) http.Handler {
 			}
 
 			if !trusted {
+				// only trusted proxies may set the request's time budget or override feature flags
+				r.Header.Del(requestTimeoutHeader)
+				for name := range r.Header {
+					if strings.HasPrefix(name, featureFlagHeaderPrefix) {
+						r.Header.Del(name)
+					}
+				}
+
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			if realIP := getRealIP(r.Header); realIP != "" {
+			r = r.WithContext(context.WithValue(r.Context(), ctxKeyTrustedProxy, true))
+
+			if realIP := getRealIP(r.Header, headers.ip, hopCount); realIP != "" {
 				r.RemoteAddr = realIP
 			}
 
-			if host := r.Header.Get(xForwardedHost); host != "" {
+			if host := firstHeader(r.Header, headers.host); host != "" {
 				r.Host = host
 			}
 
-			if scheme := getScheme(r.Header); scheme != "" {
-				r.URL.Scheme = scheme
+			if scheme := firstHeader(r.Header, headers.scheme); scheme != "" {
+				r.URL.Scheme = strings.ToLower(scheme)
 			}
 
 			next.ServeHTTP(w, r)
@@ -65,28 +136,94 @@ func trustProxy(logger *slog.Logger) func(http.Handler) http.Handler {
 	}
 }
 
+// fromTrustedProxy reports whether r was forwarded by a trusted proxy, so that headers only such a proxy is
+// expected to set, e.g. after validating them, can be relied on.
+func fromTrustedProxy(r *http.Request) bool {
+	trusted, _ := r.Context().Value(ctxKeyTrustedProxy).(bool)
+	return trusted
+}
+
+// absoluteURL resolves path, which may include a query, against r's URL and returns it as an absolute URL
+// suitable for Location headers and links. The scheme and host are those resolved by trustProxy behind a
+// trusted proxy. Otherwise, the scheme is https for TLS connections and http for others.
+func absoluteURL(r *http.Request, path string) string {
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+
+	return absoluteURLWithScheme(r, scheme, path)
+}
+
+// absoluteURLWithScheme is like absoluteURL but uses scheme instead of the request's, e.g. to redirect to the
+// HTTPS equivalent of a URL.
+func absoluteURLWithScheme(r *http.Request, scheme, path string) string {
+	base := &url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path}
+
+	// keep malformed paths as is rather than dropping them from the link, and never let a path such as
+	// `//evil.example` switch to another host
+	ref, err := url.Parse(path)
+	if err != nil || ref.Scheme != "" || ref.Host != "" || ref.User != nil {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+
+		return base.Scheme + "://" + base.Host + path
+	}
+
+	return base.ResolveReference(ref).String()
+}
+
+// parseIPs is like parseIPsSafe but panics on malformed entries. It is meant for hardcoded lists only.
 func parseIPs(ips []string) []netip.Prefix {
+	parsedIPs, err := parseIPsSafe(ips)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return parsedIPs
+}
+
+// parseIPsSafe parses IP addresses and CIDR ranges, returning an error identifying every malformed entry.
+// Use it for any user-supplied list such as TRUSTED_PROXIES.
+func parseIPsSafe(ips []string) ([]netip.Prefix, error) {
 	var parsedIPs []netip.Prefix
+	var errs []error
 
 	for _, ipStr := range ips {
 		if strings.Contains(ipStr, "/") {
 			ipNet, err := netip.ParsePrefix(ipStr)
 			if err != nil {
-				panic(fmt.Sprintf("parsing CIDR expression: %s", err.Error()))
+				errs = append(errs, fmt.Errorf("parsing CIDR expression: '%s': %w", ipStr, err))
+				continue
 			}
 
 			parsedIPs = append(parsedIPs, ipNet)
 		} else {
 			ipAddr, err := netip.ParseAddr(ipStr)
 			if err != nil {
-				panic(fmt.Sprintf("invalid IP address: '%s': %s", ipStr, err.Error()))
+				errs = append(errs, fmt.Errorf("invalid IP address: '%s': %w", ipStr, err))
+				continue
 			}
 
 			parsedIPs = append(parsedIPs, netip.PrefixFrom(ipAddr, ipAddr.BitLen()))
 		}
 	}
 
-	return parsedIPs
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return parsedIPs, nil
+}
+
+// parseTrustedProxies parses TRUSTED_PROXIES as a comma separated list of IP addresses and CIDR ranges.
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	ips, _ := parseStringSlice(value)
+	return parseIPsSafe(ips)
 }
 
 func isTrustedIP(remoteAddr string, trustedIPs []netip.Prefix) (bool, error) {
@@ -109,11 +246,21 @@ func isTrustedIP(remoteAddr string, trustedIPs []netip.Prefix) (bool, error) {
 	return false, nil
 }
 
-func getRealIP(headers http.Header) string {
+// getRealIP returns the client IP from the first of ipHeaders present. For X-Forwarded-For, the leftmost
+// address is used unless hopCount is positive, in which case the address hopCount positions from the right
+// is used, clamped to the leftmost one.
+func getRealIP(headers http.Header, ipHeaders []string, hopCount int) string {
 	var addr string
 
-	for _, proxyHeader := range proxyIPHeaders {
+	for _, proxyHeader := range ipHeaders {
 		if value := headers.Get(proxyHeader); value != "" {
+			if http.CanonicalHeaderKey(proxyHeader) == xForwardedFor && hopCount > 0 {
+				// proxies may append their own header line rather than extend the first one
+				addrs := strings.Split(strings.Join(headers.Values(proxyHeader), ","), ",")
+				addr = strings.TrimSpace(addrs[max(len(addrs)-hopCount, 0)])
+				break
+			}
+
 			addr = strings.SplitN(value, ",", 2)[0]
 			break
 		}
@@ -122,15 +269,13 @@ func getRealIP(headers http.Header) string {
 	return addr
 }
 
-func getScheme(headers http.Header) string {
-	var scheme string
-
-	for _, schemaHeader := range schemeHeaders {
-		if value := headers.Get(schemaHeader); value != "" {
-			scheme = strings.ToLower(scheme)
-			break
+// firstHeader returns the value of the first of names present in headers.
+func firstHeader(headers http.Header, names []string) string {
+	for _, name := range names {
+		if value := headers.Get(name); value != "" {
+			return value
 		}
 	}
 
-	return scheme
+	return ""
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAbsoluteURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		target     string
+		path       string
+		want       string
+	}{
+		{
+			name:       "forwarded host and scheme",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{xForwardedProto: "HTTPS", xForwardedHost: "api.example.com"},
+			target:     "/orders",
+			path:       "/orders/42?expand=items",
+			want:       "https://api.example.com/orders/42?expand=items",
+		},
+		{
+			name:       "forwarded headers from an untrusted client",
+			remoteAddr: "203.0.113.1:1234",
+			headers:    map[string]string{xForwardedProto: "https", xForwardedHost: "evil.example"},
+			target:     "/orders",
+			path:       "/orders/42",
+			want:       "http://example.com/orders/42",
+		},
+		{
+			name:       "relative path",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{xForwardedProto: "https", xForwardedHost: "api.example.com"},
+			target:     "/orders/41",
+			path:       "42",
+			want:       "https://api.example.com/orders/42",
+		},
+		{
+			name:       "network path",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{xForwardedProto: "https", xForwardedHost: "api.example.com"},
+			target:     "/",
+			path:       "//evil.example/x",
+			want:       "https://api.example.com//evil.example/x",
+		},
+		{
+			name:       "path with a scheme",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{xForwardedProto: "https", xForwardedHost: "api.example.com"},
+			target:     "/",
+			path:       "https:evil.example",
+			want:       "https://api.example.com/https:evil.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := trustProxy(slog.Default(), parsedTrustedIPs, 0, proxyProfiles[proxyProfileGeneric])(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = absoluteURL(r, tt.path)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			r.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		name         string
+		target       string
+		wantLocation string
+	}{
+		{
+			name:         "path and query",
+			target:       "/orders?page=2",
+			wantLocation: "https://api.example.com/orders?page=2",
+		},
+		{
+			name:         "network path",
+			target:       "//evil.example/x",
+			wantLocation: "https://api.example.com//evil.example/x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := trustProxy(slog.Default(), parsedTrustedIPs, 0, proxyProfiles[proxyProfileGeneric])(requireHTTPS(true)(http.NotFoundHandler()))
+
+			r := httptest.NewRequest(http.MethodGet, "http://internal:3000"+tt.target, nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			r.Header.Set(xForwardedProto, "http")
+			r.Header.Set(xForwardedHost, "api.example.com")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.wantLocation {
+				t.Errorf("got %d to %q, want %d to %q", w.Code, w.Header().Get("Location"), http.StatusPermanentRedirect, tt.wantLocation)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// firstByteWriter records when the response was first committed, by WriteHeader, Write, or Flush,
+// so that the time to first byte can be told apart from the total duration of a request.
+type firstByteWriter struct {
+	middleware.WrapResponseWriter
+	clk       clock
+	firstByte time.Time
+}
+
+func newFirstByteWriter(w middleware.WrapResponseWriter, clk clock) *firstByteWriter {
+	return &firstByteWriter{WrapResponseWriter: w, clk: clk}
+}
+
+func (w *firstByteWriter) mark() {
+	if w.firstByte.IsZero() {
+		w.firstByte = w.clk.Now()
+	}
+}
+
+func (w *firstByteWriter) WriteHeader(code int) {
+	w.mark()
+	w.WrapResponseWriter.WriteHeader(code)
+}
+
+func (w *firstByteWriter) Write(b []byte) (int, error) {
+	w.mark()
+	return w.WrapResponseWriter.Write(b)
+}
+
+func (w *firstByteWriter) Flush() {
+	if f, ok := w.WrapResponseWriter.(http.Flusher); ok {
+		w.mark()
+		f.Flush()
+	}
+}
+
+func (w *firstByteWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.WrapResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking connection: response writer does not support hijacking")
+	}
+
+	return hj.Hijack()
+}
+
+// timeToFirstByte returns how long after start the response was first committed,
+// and false when nothing was written.
+func (w *firstByteWriter) timeToFirstByte(start time.Time) (time.Duration, bool) {
+	if w.firstByte.IsZero() {
+		return 0, false
+	}
+
+	return w.firstByte.Sub(start), true
+}
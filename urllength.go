@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// limitURLLength rejects requests whose escaped URL path exceeds maxPathBytes or whose raw query
+// exceeds maxQueryBytes with a 414 before they are routed or logged.
+func limitURLLength(maxPathBytes, maxQueryBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if n := int64(len(r.URL.EscapedPath())); n > maxPathBytes {
+				writeProblem(w, r, http.StatusRequestURITooLong, fmt.Sprintf("URL path of %d bytes exceeds the maximum of %d bytes", n, maxPathBytes))
+				return
+			}
+
+			if n := int64(len(r.URL.RawQuery)); n > maxQueryBytes {
+				writeProblem(w, r, http.StatusRequestURITooLong, fmt.Sprintf("query string of %d bytes exceeds the maximum of %d bytes", n, maxQueryBytes))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
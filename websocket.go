@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// webSocketCloseTimeout bounds how long sending a close frame may block on a slow client.
+const webSocketCloseTimeout = time.Second
+
+// webSockets tracks open WebSocket connections. Hijacked connections are invisible to
+// http.Server.Shutdown, so they are closed with a close frame when the server shuts down
+// and waited on separately.
+type webSockets struct {
+	upgrader  websocket.Upgrader
+	readLimit int64
+
+	mu      sync.Mutex
+	closing bool
+	conns   map[*websocket.Conn]struct{}
+	wg      sync.WaitGroup
+}
+
+// newWebSockets returns a tracker whose connections reject messages larger than readLimit bytes.
+func newWebSockets(readLimit int64) *webSockets {
+	return &webSockets{
+		readLimit: readLimit,
+		conns:     map[*websocket.Conn]struct{}{},
+	}
+}
+
+// track registers conn as open. It returns false once the server is shutting down.
+func (ws *webSockets) track(conn *websocket.Conn) bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closing {
+		return false
+	}
+
+	ws.conns[conn] = struct{}{}
+	ws.wg.Add(1)
+
+	return true
+}
+
+func (ws *webSockets) untrack(conn *websocket.Conn) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	delete(ws.conns, conn)
+	ws.wg.Done()
+}
+
+// close sends a close frame to every open connection and rejects new ones.
+// Handlers see the client's reply to the close frame as a read error and return.
+func (ws *webSockets) close() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	ws.closing = true
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for conn := range ws.conns {
+		conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(webSocketCloseTimeout))
+	}
+}
+
+// wait blocks until all connections are closed. Connections still open once ctx is done are
+// closed forcibly and ctx's error is returned.
+func (ws *webSockets) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ws.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		ws.mu.Lock()
+		for conn := range ws.conns {
+			conn.Close()
+		}
+		ws.mu.Unlock()
+
+		return errWrap(ctx.Err(), "waiting for websocket connections to close")
+	}
+}
+
+// echo upgrades the request to a WebSocket connection which echoes back every message it receives.
+func (ws *webSockets) echo(w http.ResponseWriter, r *http.Request) {
+	conn, err := ws.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already responded with an error
+		return
+	}
+	defer conn.Close()
+
+	if !ws.track(conn) {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "server shutting down"), time.Now().Add(webSocketCloseTimeout))
+		return
+	}
+	defer ws.untrack(conn)
+
+	conn.SetReadLimit(ws.readLimit)
+
+	for {
+		typ, msg, err := conn.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			// replies to the close frame sent on shutdown surface as ErrCloseSent
+			if !errors.As(err, &closeErr) && !errors.Is(err, websocket.ErrCloseSent) {
+				getLogger(r).Warn("WebSocket read", slog.Any("error", err))
+			}
+			return
+		}
+
+		if err := conn.WriteMessage(typ, msg); err != nil {
+			getLogger(r).Warn("WebSocket write", slog.Any("error", err))
+			return
+		}
+	}
+}
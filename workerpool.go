@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var errQueueFull = errors.New("worker pool queue is full")
+var errPoolClosed = errors.New("worker pool is shut down")
+
+// workerPool runs background jobs on a fixed number of workers fed by a bounded queue,
+// so that handlers can hand off fire-and-forget work without spawning unbounded goroutines.
+type workerPool struct {
+	jobs   chan func(ctx context.Context)
+	logger *slog.Logger
+
+	// ctx is passed to jobs and canceled when draining the queue on shutdown times out
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// newWorkerPool starts workers goroutines consuming a queue of up to queueSize jobs.
+// The queue depth is reported by the worker_pool_queue_depth gauge.
+func newWorkerPool(workers, queueSize int, logger *slog.Logger) (*workerPool, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	wp := &workerPool{
+		jobs:   make(chan func(ctx context.Context), queueSize),
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	_, err := otel.Meter(instrumentationName).Int64ObservableGauge(
+		"worker_pool_queue_depth",
+		metric.WithDescription("Number of background jobs waiting for a worker"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(len(wp.jobs)))
+			return nil
+		}),
+	)
+	if err != nil {
+		cancel()
+		return nil, errWrap(err, "creating worker pool queue depth gauge")
+	}
+
+	wp.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go wp.work()
+	}
+
+	return wp, nil
+}
+
+func (wp *workerPool) work() {
+	defer wp.wg.Done()
+
+	for job := range wp.jobs {
+		wp.run(job)
+	}
+}
+
+func (wp *workerPool) run(job func(ctx context.Context)) {
+	defer func() {
+		if v := recover(); v != nil {
+			wp.logger.Error("panic caught", slog.Any("panic", v), slog.String("stack", string(debug.Stack())))
+		}
+	}()
+
+	job(wp.ctx)
+}
+
+// submit queues job to be run by a worker. It returns errQueueFull rather than blocking when the
+// queue is full, and errPoolClosed once the pool is shut down. Jobs must not capture the request
+// context, which is canceled as soon as the handler returns, and should honor the context they are given.
+func (wp *workerPool) submit(job func(ctx context.Context)) error {
+	wp.mu.RLock()
+	defer wp.mu.RUnlock()
+
+	if wp.closed {
+		return errPoolClosed
+	}
+
+	select {
+	case wp.jobs <- job:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+// shutdown stops accepting jobs and waits for the queued ones to complete. When ctx is done first,
+// the context given to jobs is canceled and ctx's error is returned.
+func (wp *workerPool) shutdown(ctx context.Context) error {
+	wp.mu.Lock()
+	if !wp.closed {
+		wp.closed = true
+		close(wp.jobs)
+	}
+	wp.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		wp.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		wp.cancel()
+		return nil
+	case <-ctx.Done():
+		wp.cancel()
+		return errWrap(ctx.Err(), "draining worker pool")
+	}
+}